@@ -0,0 +1,560 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/catalog"
+	"github.com/bytekai/docker-auto-backup/internal/config"
+	"github.com/bytekai/docker-auto-backup/internal/lease"
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/manager"
+	"github.com/bytekai/docker-auto-backup/internal/naming"
+	"github.com/bytekai/docker-auto-backup/internal/notifier"
+	"github.com/bytekai/docker-auto-backup/internal/pool"
+	"github.com/bytekai/docker-auto-backup/internal/provider"
+	"github.com/bytekai/docker-auto-backup/internal/retry"
+	"github.com/bytekai/docker-auto-backup/internal/scheduler"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+	"github.com/bytekai/docker-auto-backup/internal/verify"
+)
+
+type daemon struct {
+	global  *config.Config
+	catalog *catalog.Catalog
+	hosts   []*host
+	pool    *pool.Pool
+	log     *logger.Logger
+	dryRun  bool
+	// elector decides which of several agents schedules jobs; nil when
+	// leader election is off.
+	elector *lease.Elector
+}
+
+func newDaemon(log *logger.Logger, dryRun bool) (*daemon, error) {
+	configPath, required := os.LookupEnv("BACKUP_CONFIG")
+	if !required {
+		configPath = config.DefaultPath
+	}
+	global, err := config.Load(configPath, required)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %v", err)
+	}
+
+	// Without configured hosts, manage the engine from the environment.
+	hostConfigs := global.Hosts
+	if len(hostConfigs) == 0 {
+		hostConfigs = []config.Host{{}}
+	}
+	hosts := make([]*host, 0, len(hostConfigs))
+	for _, cfg := range hostConfigs {
+		h, err := newHost(log, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %v", cfg.Name, err)
+		}
+		hosts = append(hosts, h)
+	}
+
+	// Backups still run without a catalog; they just aren't recorded locally.
+	cat, err := catalog.Open(catalogPath())
+	if err != nil {
+		log.NewSession("[catalog] ").Warn("Catalog disabled: %v", err)
+	}
+
+	var elector *lease.Elector
+	if le := global.LeaderElection; le != nil {
+		elector, err = newElector(log, global, le)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &daemon{
+		elector: elector,
+		hosts:   hosts,
+		pool:    pool.New(global.Concurrency.Max, global.Concurrency.PerDestination),
+		global:  global,
+		catalog: cat,
+		log:     log,
+		dryRun:  dryRun,
+	}, nil
+}
+
+// newElector creates the elector for the lease in the named storage.
+func newElector(log *logger.Logger, global *config.Config, le *config.LeaderElection) (*lease.Elector, error) {
+	destinations, err := buildDestinations(global.Merge(map[string]string{"storage": le.Storage}))
+	if err != nil {
+		return nil, fmt.Errorf("leader election: %v", err)
+	}
+	dest := destinations[0]
+	s := storage.NewStorage(&provider.ProviderContext{Session: log.NewSession("[leader] ")}, dest.Type, dest.Config)
+	if s == nil {
+		return nil, fmt.Errorf("leader election: failed to create storage %s (%s)", dest.Name, dest.Type)
+	}
+
+	// Redundant agents often share a hostname, e.g. from a compose file,
+	// so a random suffix tells them apart.
+	id := le.ID
+	if id == "" {
+		hostname, _ := os.Hostname()
+		suffix := make([]byte, 3)
+		rand.Read(suffix)
+		id = hostname + "-" + hex.EncodeToString(suffix)
+	}
+
+	return lease.New(s, le.Key, id, le.TTL), nil
+}
+
+// elect competes for leadership until ctx is done. Gaining or losing it
+// reconciles every host, so only the leader has jobs scheduled.
+func (d *daemon) elect(ctx context.Context) {
+	session := d.log.NewSession("[leader] ")
+	d.elector.Run(ctx, func(leading bool, token uint64) {
+		if leading {
+			session.Info("Became the leader with token %d", token)
+		} else {
+			session.Warn("Lost leadership, unscheduling jobs")
+		}
+		for _, h := range d.hosts {
+			h.requestReconcile()
+		}
+	})
+}
+
+// leading reports whether this agent should schedule jobs.
+func (d *daemon) leading() bool {
+	if d.elector == nil {
+		return true
+	}
+	leading, _ := d.elector.Leading()
+	return leading
+}
+
+// fence confirms that this agent still leads before a run starts and returns
+// the lease token to record with it. A run must not start if another agent
+// took over; the error then wraps lease.ErrNotLeader.
+func (d *daemon) fence(ctx context.Context) (uint64, error) {
+	if d.elector == nil {
+		return 0, nil
+	}
+	token, err := d.elector.Check(ctx)
+	if errors.Is(err, lease.ErrNotLeader) {
+		return 0, retry.Permanent(fmt.Errorf("skipped, another agent is the leader: %w", err))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to confirm leadership: %w", err)
+	}
+	return token, nil
+}
+
+func catalogPath() string {
+	if path := os.Getenv("BACKUP_CATALOG"); path != "" {
+		return path
+	}
+	return catalog.DefaultPath
+}
+
+// schedule (re)creates the schedulers of job j, replacing any it had.
+func (d *daemon) schedule(ctx context.Context, j job, config *scheduler.Config, hash string) error {
+	session := d.log.NewSession(fmt.Sprintf("[backup] [%s] ", j.Name)).With(j.fields(config)...)
+
+	json, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+
+	session.Info("Config for job %s: %s", j, string(json))
+
+	sch, err := scheduler.New(*config, func(ctx context.Context) error {
+		if d.dryRun {
+			session.Info("Executing dry run for job: %s", j)
+			if err := d.runDryRun(ctx, session, config, j); err != nil {
+				session.Error("Dry run failed for job %s: %v", j, err)
+			}
+			// Checks are repeated on the next tick, not retried.
+			return nil
+		}
+
+		attempt, attempts := retry.Attempt(ctx)
+		session.Info("Executing backup task for job: %s (attempt %d of %d)", j, attempt, attempts)
+		err := d.runBackup(ctx, session, config, j)
+		if errors.Is(err, lease.ErrNotLeader) {
+			// Leadership moved on; the new leader schedules this job.
+			session.Info("Skipping backup of job %s: %v", j, err)
+			return nil
+		}
+		if err != nil {
+			session.Error("Failed to backup job %s: %v", j, err)
+		}
+		return err
+	}, scheduler.WithLogger(d.log), scheduler.WithJob(j.Name), scheduler.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to create scheduler: %v", err)
+	}
+
+	schedulers := []scheduler.Scheduler{sch}
+
+	if config.Verify != nil && !d.dryRun {
+		verifySch, err := scheduler.New(config.Verify.Schedule, func(ctx context.Context) error {
+			session.Info("Executing restore verification for job: %s", j)
+			err := d.runVerify(ctx, session, config, j)
+			if errors.Is(err, lease.ErrNotLeader) {
+				session.Info("Skipping restore verification for job %s: %v", j, err)
+				return nil
+			}
+			if err != nil {
+				session.Error("Restore verification failed for job %s: %v", j, err)
+			}
+			return err
+		}, scheduler.WithLogger(d.log), scheduler.WithJob(j.Name), scheduler.WithContext(ctx))
+		if err != nil {
+			return fmt.Errorf("failed to create verify scheduler: %v", err)
+		}
+		schedulers = append(schedulers, verifySch)
+	}
+
+	return j.host.mgr.AddScheduler(j.Name, manager.Job{ContainerID: j.ContainerID, Hash: hash}, schedulers...)
+}
+
+// shutdown stops scheduling new runs and lets running ones finish within
+// the grace period before cancelling them through cancelRuns.
+func (d *daemon) shutdown(session *logger.Session, cancelRuns context.CancelFunc) {
+	grace := d.global.ShutdownGrace
+	session.Info("Shutting down, waiting up to %v for running backups", grace)
+
+	d.pool.Close()
+	if d.elector != nil {
+		// Hand over right away; runs that already started finish under
+		// the token they were fenced with.
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := d.elector.Release(ctx); err != nil {
+			session.Warn("Failed to release leader lease: %v", err)
+		}
+		cancel()
+	}
+	var stopped []context.Context
+	for _, h := range d.hosts {
+		stopped = append(stopped, h.mgr.StopAll())
+	}
+	drained, allStopped := context.WithCancel(context.Background())
+	go func() {
+		for _, ctx := range stopped {
+			<-ctx.Done()
+		}
+		allStopped()
+	}()
+
+	select {
+	case <-drained.Done():
+		session.Info("All runs finished")
+	case <-time.After(grace):
+		stats := d.pool.Stats()
+		session.Warn("Grace period expired, cancelling %d running backups", stats.Running)
+		cancelRuns()
+
+		// Cancelled runs still kill their processes and remove partial
+		// uploads before returning.
+		select {
+		case <-drained.Done():
+			session.Info("Cancelled runs cleaned up")
+		case <-time.After(30 * time.Second):
+			session.Error("Runs did not stop after cancellation, exiting anyway")
+		}
+	}
+	cancelRuns()
+}
+
+func (d *daemon) providerContext(session *logger.Session, config *scheduler.Config, j job) *provider.ProviderContext {
+	return &provider.ProviderContext{
+		Session:     session,
+		Client:      j.host.cli,
+		ContainerID: j.ContainerID,
+		Namer:       d.namer(session, config, j),
+	}
+}
+
+func (d *daemon) namer(session *logger.Session, config *scheduler.Config, j job) *naming.Namer {
+	namer, err := naming.New(config.Naming, naming.Vars{
+		Job:      j.Name,
+		Name:     j.Container,
+		Project:  j.Project,
+		Service:  j.Service,
+		Provider: config.Provider,
+		Hostname: j.host.hostname,
+	}, config.TimeZone)
+	if err != nil {
+		session.Warn("Ignoring naming template of job %s: %v", j, err)
+		return nil
+	}
+	return namer
+}
+
+// acquire waits for the pool to admit a run of j and logs how long it was
+// queued. The returned function releases the slot.
+func (d *daemon) acquire(ctx context.Context, session *logger.Session, config *scheduler.Config, j job) (func(), time.Duration, error) {
+	destinations := make([]string, 0, len(config.Destinations))
+	for _, dest := range config.Destinations {
+		destinations = append(destinations, dest.Name)
+	}
+
+	release, waited, err := d.pool.Acquire(ctx, pool.Request{
+		Job:          j.Name,
+		Priority:     config.Priority,
+		Destinations: destinations,
+	})
+	if errors.Is(err, pool.ErrClosed) {
+		return nil, waited, retry.Permanent(errors.New("daemon is shutting down"))
+	}
+	if err != nil {
+		return nil, waited, fmt.Errorf("gave up waiting in queue after %v: %w", waited.Round(time.Millisecond), err)
+	}
+
+	stats := d.pool.Stats()
+	if waited >= time.Second {
+		session.Info("Job %s waited %v in queue (%d running, %d queued)", j, waited.Round(time.Millisecond), stats.Running, stats.Queued)
+	} else {
+		session.Debug("Job %s started without queueing (%d running, %d queued)", j, stats.Running, stats.Queued)
+	}
+	return release, waited, nil
+}
+
+func (d *daemon) runBackup(ctx context.Context, session *logger.Session, config *scheduler.Config, j job) error {
+	release, waited, err := d.acquire(ctx, session, config, j)
+	if err != nil {
+		notifyFinal(ctx, session, config, j, err)
+		return err
+	}
+	defer release()
+
+	token, err := d.fence(ctx)
+	if err != nil {
+		if !errors.Is(err, lease.ErrNotLeader) {
+			notifyFinal(ctx, session, config, j, err)
+		}
+		return err
+	}
+
+	attempt, _ := retry.Attempt(ctx)
+
+	entry := &catalog.Entry{
+		Job:          j.Name,
+		ContainerID:  j.ContainerID,
+		Provider:     config.Provider,
+		StartedAt:    time.Now(),
+		QueueWait:    waited,
+		Attempt:      attempt,
+		FencingToken: token,
+	}
+	entry.ID = catalog.NewID(entry.StartedAt)
+	session = session.With("run_id", entry.ID, "attempt", attempt)
+	if info, err := j.host.cli.ContainerInspect(ctx, j.ContainerID); err == nil {
+		entry.Container = strings.TrimPrefix(info.Name, "/")
+		entry.Image = info.Config.Image
+	}
+
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if config.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, config.Timeout)
+	}
+	err = d.backup(runCtx, session, config, j, entry)
+	if err != nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("backup timed out after %v: %w", config.Timeout, err)
+	}
+	cancel()
+	entry.Duration = time.Since(entry.StartedAt)
+	entry.Status = catalog.Success
+	if err != nil {
+		entry.Status = catalog.Failure
+		entry.Error = err.Error()
+	}
+
+	// A run fenced off before publishing is the new leader's to report.
+	if errors.Is(err, lease.ErrNotLeader) {
+		return err
+	}
+
+	if d.catalog != nil {
+		if recordErr := d.catalog.Record(entry); recordErr != nil {
+			session.Warn("Failed to record backup of job %s in catalog: %v", j, recordErr)
+		}
+	}
+
+	notifyFinal(ctx, session, config, j, err)
+	return err
+}
+
+// notifyFinal notifies about the outcome of a backup unless the run will
+// be retried.
+func notifyFinal(ctx context.Context, session *logger.Session, config *scheduler.Config, j job, err error) {
+	if !retry.Final(ctx, err) {
+		attempt, attempts := retry.Attempt(ctx)
+		session.Info("Attempt %d of %d for job %s failed, notifying only if the last attempt fails", attempt, attempts, j)
+		return
+	}
+	notify(session, config, j, err)
+}
+
+func (d *daemon) backup(ctx context.Context, session *logger.Session, config *scheduler.Config, j job, entry *catalog.Entry) error {
+	pCtx := d.providerContext(session, config, j)
+
+	p := provider.NewProvider(pCtx, config.Provider, config.ProviderConfig)
+	if p == nil {
+		return retry.Permanent(fmt.Errorf("unsupported provider: %s", config.Provider))
+	}
+
+	storage := storage.NewDestinations(pCtx, config.Destinations, config.StoragePolicy)
+	tracker := catalog.Track(storage)
+
+	err := p.Backup(ctx, tracker)
+	entry.Object, entry.Size, entry.Checksum = tracker.Written()
+	if entry.Object != "" {
+		removePartial(session, storage, entry.Object, err != nil)
+	}
+
+	types := make(map[string]string, len(config.Destinations))
+	for _, dest := range config.Destinations {
+		types[dest.Name] = dest.Type
+	}
+	for _, result := range storage.Results() {
+		dest := catalog.Destination{Name: result.Destination, Type: types[result.Destination], Bytes: result.Bytes}
+		session := session.With("storage", result.Destination, "storage_type", dest.Type)
+		if result.Err != nil {
+			dest.Error = result.Err.Error()
+			session.Warn("Destination %s failed for job %s: %v", result.Destination, j, result.Err)
+		} else {
+			session.Info("Destination %s stored %d bytes for job %s in %v", result.Destination, result.Bytes, j, result.Duration)
+		}
+		entry.Destinations = append(entry.Destinations, dest)
+	}
+	if err != nil {
+		return err
+	}
+	if entry.Object == "" {
+		// A manifest would describe an object that doesn't exist.
+		return retry.Permanent(fmt.Errorf("provider %s wrote no backup", config.Provider))
+	}
+
+	// Another agent may have taken over during a long run; it then owns
+	// the job and a deposed leader's backup must not be published.
+	if _, err := d.fence(ctx); err != nil {
+		removePartial(session, storage, entry.Object, true)
+		return err
+	}
+
+	// The manifest lets the catalog be rebuilt from storage. It is written
+	// before the run is finished, so record it as successful up front.
+	manifest := *entry
+	manifest.Status = catalog.Success
+	manifest.Duration = time.Since(entry.StartedAt)
+	if err := catalog.WriteManifest(ctx, storage.Succeeded(), &manifest); err != nil {
+		session.Warn("Failed to write manifest for %s: %v", entry.Object, err)
+	}
+
+	return nil
+}
+
+// removePartial deletes what a backup left incomplete so it isn't mistaken
+// for a usable backup. Destinations that failed hold incomplete objects even
+// when the storage policy tolerates them; with everywhere, e.g. because the
+// provider failed, none of the copies can be trusted.
+func removePartial(session *logger.Session, s *storage.MultiStorage, object string, everywhere bool) {
+	// The run's context may be what failed it.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if everywhere {
+		if err := s.Delete(ctx, object); err != nil {
+			session.Debug("Could not remove partial backup %s: %v", object, err)
+			return
+		}
+		session.Info("Removed partial backup %s", object)
+		return
+	}
+
+	failed, err := s.DeleteFailed(ctx, object)
+	if !failed {
+		return
+	}
+	if err != nil {
+		session.Debug("Could not remove partial backup %s from failed destinations: %v", object, err)
+		return
+	}
+	session.Info("Removed partial backup %s from failed destinations", object)
+}
+
+func (d *daemon) runVerify(ctx context.Context, session *logger.Session, config *scheduler.Config, j job) error {
+	release, _, err := d.acquire(ctx, session, config, j)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, err := d.fence(ctx); err != nil {
+		return err
+	}
+
+	pCtx := d.providerContext(session, config, j)
+	storage := storage.NewDestinations(pCtx, config.Destinations, config.StoragePolicy)
+
+	prefix := ""
+	if p := provider.NewProvider(pCtx, config.Provider, config.ProviderConfig); p != nil && pCtx.Namer != nil {
+		prefix = pCtx.Namer.Prefix(p.Ext())
+	}
+
+	result, err := verify.New(j.host.cli, session).Run(ctx, j.ContainerID, storage, verify.Options{
+		Provider:       config.Provider,
+		ProviderConfig: config.ProviderConfig,
+		Command:        config.Verify.Command,
+		Prefix:         prefix,
+		Timeout:        config.Verify.Timeout,
+	})
+	if err != nil {
+		err = fmt.Errorf("verification of %s failed: %w", result.Object, err)
+		notify(session, config, j, err)
+		return err
+	}
+
+	session.Info("Verified %s for job %s in %v: %s", result.Object, j, result.Duration, result.Summary)
+	return nil
+}
+
+func notify(session *logger.Session, config *scheduler.Config, j job, backupErr error) {
+	// The run's context may be done, e.g. after a timeout, which is just
+	// what the notification reports.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	event := notifier.Event{
+		Job:       j.Name,
+		Container: j.ContainerID,
+		Provider:  config.Provider,
+		Status:    notifier.Success,
+		Time:      time.Now(),
+	}
+	if backupErr != nil {
+		event.Status = notifier.Failure
+		event.Error = backupErr.Error()
+	}
+
+	for _, c := range config.Notifiers {
+		if !c.Wants(event.Status) {
+			continue
+		}
+
+		n, err := notifier.New(c)
+		if err != nil {
+			session.Error("Failed to create notifier %s: %v", c.Name, err)
+			continue
+		}
+		if err := n.Notify(ctx, event); err != nil {
+			session.Error("Failed to send notification via %s: %v", c.Name, err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/provider"
+	"github.com/bytekai/docker-auto-backup/internal/retry"
+	"github.com/bytekai/docker-auto-backup/internal/scheduler"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+	"github.com/docker/docker/api/types/container"
+)
+
+const probePrefix = ".docker-auto-backup-probe-"
+
+// runDryRun resolves everything a backup of containerID needs and checks it
+// end to end without writing a backup: every destination receives and loses
+// a small probe object, and the provider runs its preflight checks.
+func (d *daemon) runDryRun(ctx context.Context, session *logger.Session, config *scheduler.Config, j job) error {
+	pCtx := d.providerContext(session, config, j)
+
+	var errs []error
+
+	p := provider.NewProvider(pCtx, config.Provider, config.ProviderConfig)
+	if p == nil {
+		errs = append(errs, fmt.Errorf("unsupported provider: %s", config.Provider))
+	} else if err := p.Preflight(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("provider %s preflight failed: %w", config.Provider, err))
+	} else {
+		session.Info("Provider %s preflight passed for job %s", config.Provider, j)
+	}
+
+	var writable []string
+	for _, dest := range config.Destinations {
+		if err := probeDestination(ctx, pCtx, dest); err != nil {
+			errs = append(errs, fmt.Errorf("storage %s (%s): %w", dest.Name, dest.Type, err))
+			continue
+		}
+		writable = append(writable, dest.Name)
+		session.Info("Storage %s (%s) is writable", dest.Name, dest.Type)
+	}
+
+	if p != nil && len(writable) > 0 {
+		session.Info("Would write %s to %s (policy %s)", p.ObjectName(time.Now()), strings.Join(writable, ", "), config.StoragePolicy)
+	}
+
+	return errors.Join(errs...)
+}
+
+func probeDestination(ctx context.Context, pCtx *provider.ProviderContext, dest storage.Destination) error {
+	if err := dest.Config.Validate(dest.Type); err != nil {
+		return err
+	}
+
+	s := storage.NewStorage(pCtx, dest.Type, dest.Config)
+	if s == nil {
+		return fmt.Errorf("failed to create storage")
+	}
+
+	name := fmt.Sprintf("%s%d", probePrefix, time.Now().UnixNano())
+	if err := s.Put(ctx, name, strings.NewReader("probe")); err != nil {
+		return fmt.Errorf("write probe failed: %w", err)
+	}
+	if err := s.Delete(ctx, name); err != nil {
+		return fmt.Errorf("failed to remove probe object %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// runBackupCommand runs a backup, or with --dry-run only its checks, right
+// away for the named jobs or containers or for every enabled container.
+func runBackupCommand(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "check config, storage and provider without writing a backup")
+	fs.Parse(args)
+
+	log, err := logger.FromEnv(logger.INFO)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	session := log.NewSession("[backup] ")
+
+	d, err := newDaemon(log, *dryRun)
+	if err != nil {
+		session.Error("%v", err)
+		return 1
+	}
+	// An explicit run is the operator's call and doesn't compete for the
+	// leader lease; without the election running, fencing would skip it.
+	d.elector = nil
+
+	ctx := context.Background()
+
+	wanted := make(map[string]bool)
+	for _, name := range fs.Args() {
+		wanted[name] = true
+	}
+
+	failed, ran := 0, 0
+	for _, h := range d.hosts {
+		containers, err := h.cli.ContainerList(ctx, container.ListOptions{})
+		if err != nil {
+			session.Error("Failed to list containers on %s: %v", h.label(), err)
+			failed++
+			continue
+		}
+		h.detectEngine(ctx, session)
+
+		for _, c := range containers {
+			if !h.managed(c) {
+				continue
+			}
+			j := h.job(c.ID, containerName(c.Names), c.Labels)
+			if len(wanted) > 0 && !wanted[j.Name] && !matchesContainer(wanted, c.ID, c.Names) {
+				continue
+			}
+
+			config, err := parseConfig(d.global, extractLabels(c.Labels))
+			if err != nil {
+				session.Error("Failed to parse config for container %s: %v", c.ID, err)
+				failed++
+				continue
+			}
+			if !config.Enabled {
+				continue
+			}
+
+			ran++
+			if *dryRun {
+				err = d.runDryRun(ctx, session, config, j)
+			} else {
+				err = retry.Do(ctx, config.Retry, func(ctx context.Context) error {
+					return d.runBackup(ctx, session, config, j)
+				}, func(attempt int, delay time.Duration, err error) {
+					session.Warn("Attempt %d of %d for job %s failed, retrying in %v: %v", attempt, config.Retry.Attempts, j, delay, err)
+				})
+			}
+			if err != nil {
+				session.Error("Job %s: %v", j, err)
+				failed++
+			}
+		}
+	}
+
+	if ran == 0 {
+		session.Warn("No enabled containers matched")
+	}
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func matchesContainer(wanted map[string]bool, id string, names []string) bool {
+	if wanted[id] || wanted[id[:min(12, len(id))]] {
+		return true
+	}
+	for _, name := range names {
+		if wanted[strings.TrimPrefix(name, "/")] {
+			return true
+		}
+	}
+	return false
+}
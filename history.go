@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/catalog"
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/provider"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+	"github.com/docker/docker/api/types/container"
+)
+
+// runListCommand prints the backup history recorded in the catalog.
+func runListCommand(args []string) int {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	job := fs.String("job", "", "only show runs of this job or container")
+	status := fs.String("status", "", "only show runs with this status (success or failure)")
+	limit := fs.Int("limit", 20, "maximum number of runs to show, 0 for all")
+	asJSON := fs.Bool("json", false, "print runs as JSON")
+	fs.Parse(args)
+
+	cat, err := catalog.Open(catalogPath())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	entries, err := cat.List(catalog.Filter{Job: *job, Status: catalog.Status(*status), Limit: *limit})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if *asJSON {
+		return printJSON(entries)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tJOB\tSTATUS\tSTARTED\tDURATION\tSIZE\tOBJECT")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			e.ID, e.Job, e.Status, e.StartedAt.Local().Format("2006-01-02 15:04:05"),
+			e.Duration.Round(time.Millisecond), e.Size, e.Object)
+	}
+	w.Flush()
+	return 0
+}
+
+// runShowCommand prints every recorded detail of a single run.
+func runShowCommand(args []string) int {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: docker-auto-backup show <run-id>")
+		return 2
+	}
+
+	cat, err := catalog.Open(catalogPath())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	entry, err := cat.Get(fs.Arg(0))
+	if errors.Is(err, catalog.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "run %s not found\n", fs.Arg(0))
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return printJSON(entry)
+}
+
+// runRebuildCommand restores the catalog from the manifests stored next to
+// each backup, reading the destinations of every enabled container.
+func runRebuildCommand(args []string) int {
+	fs := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	fs.Parse(args)
+
+	log, err := logger.FromEnv(logger.INFO)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	session := log.NewSession("[catalog] ")
+
+	d, err := newDaemon(log, false)
+	if err != nil {
+		session.Error("%v", err)
+		return 1
+	}
+	if d.catalog == nil {
+		return 1
+	}
+
+	ctx := context.Background()
+	seen := make(map[string]bool)
+	failed, total := 0, 0
+	rebuild := func(pCtx *provider.ProviderContext, dest storage.Destination) {
+		// Containers commonly share destinations; read each one once.
+		settings, _ := json.Marshal(dest.Config)
+		key := dest.Type + string(settings)
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+
+		s := storage.NewStorage(pCtx, dest.Type, dest.Config)
+		if s == nil {
+			session.Error("Failed to create storage %s (%s)", dest.Name, dest.Type)
+			failed++
+			return
+		}
+
+		n, err := d.catalog.Rebuild(ctx, s)
+		total += n
+		if err != nil {
+			session.Error("Storage %s (%s): %v", dest.Name, dest.Type, err)
+			failed++
+		}
+		session.Info("Imported %d runs from storage %s (%s)", n, dest.Name, dest.Type)
+	}
+
+	for _, h := range d.hosts {
+		containers, err := h.cli.ContainerList(ctx, container.ListOptions{All: true})
+		if err != nil {
+			session.Error("Failed to list containers on %s: %v", h.label(), err)
+			failed++
+			continue
+		}
+
+		for _, c := range containers {
+			config, err := parseConfig(d.global, extractLabels(c.Labels))
+			if err != nil || !config.Enabled {
+				continue
+			}
+
+			pCtx := d.providerContext(session, config, h.job(c.ID, containerName(c.Names), c.Labels))
+			for _, dest := range config.Destinations {
+				rebuild(pCtx, dest)
+			}
+		}
+	}
+
+	// Storages of the config file may hold runs of containers that are gone.
+	for _, name := range d.global.StorageNames() {
+		destinations, err := buildDestinations(d.global.Merge(map[string]string{"storage": name}))
+		if err != nil {
+			session.Error("Storage %s: %v", name, err)
+			failed++
+			continue
+		}
+		for _, dest := range destinations {
+			rebuild(&provider.ProviderContext{Session: session}, dest)
+		}
+	}
+
+	session.Info("Rebuilt catalog with %d runs", total)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printJSON(v any) int {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
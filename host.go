@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/config"
+	"github.com/bytekai/docker-auto-backup/internal/dockerhost"
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/manager"
+	"github.com/bytekai/docker-auto-backup/internal/verify"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// host is a Docker engine whose containers the daemon backs up. Each host
+// has its own watcher and manager.
+type host struct {
+	// name namespaces the host's jobs. It is empty when the daemon manages
+	// the single engine from its environment, keeping job names unchanged.
+	name     string
+	endpoint string
+	cli      *client.Client
+	// hostname is the engine's name, used in object names.
+	hostname string
+	mgr      *manager.Manager
+	// invalid holds the label hash of jobs whose config failed to parse,
+	// so each broken version is only reported once. It is owned by the
+	// host's reconcile loop.
+	invalid map[string]string
+	// workerWarned is set once the loop warned that this Swarm node can't
+	// see the cluster's services and tasks.
+	workerWarned bool
+	// trigger holds a pending request to reconcile.
+	trigger chan struct{}
+
+	mu     sync.Mutex
+	status hostStatus
+	// podman is set once the engine is detected as Podman.
+	podman bool
+}
+
+// hostStatus is a host's connectivity as reported by health and metrics.
+type hostStatus struct {
+	Name      string    `json:"name"`
+	Endpoint  string    `json:"endpoint,omitempty"`
+	Engine    string    `json:"engine,omitempty"`
+	Connected bool      `json:"connected"`
+	Error     string    `json:"error,omitempty"`
+	Since     time.Time `json:"since"`
+	Jobs      int       `json:"jobs"`
+}
+
+func newHost(log *logger.Logger, cfg config.Host) (*host, error) {
+	cli, err := dockerhost.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client: %v", err)
+	}
+
+	h := &host{
+		name:     cfg.Name,
+		endpoint: cfg.Endpoint,
+		cli:      cli,
+		mgr:      manager.New(log),
+		invalid:  make(map[string]string),
+		trigger:  make(chan struct{}, 1),
+		status:   hostStatus{Error: "not connected yet", Since: time.Now()},
+	}
+
+	// Unreachable hosts are retried by their watcher; don't block startup.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if info, err := cli.Info(ctx); err == nil {
+		h.hostname = info.Name
+	} else if cfg.Name != "" {
+		h.hostname = cfg.Name
+	} else {
+		h.hostname, _ = os.Hostname()
+	}
+	h.status.Name = h.label()
+
+	return h, nil
+}
+
+// label names the host in logs and metrics.
+func (h *host) label() string {
+	if h.name != "" {
+		return h.name
+	}
+	return h.hostname
+}
+
+// job returns the job of one of the host's containers.
+func (h *host) job(containerID, containerName string, labels map[string]string) job {
+	j := newJob(containerID, containerName, labels)
+	if h.name != "" {
+		j.Name = h.name + "/" + j.Name
+	}
+	j.host = h
+	return j
+}
+
+// detectEngine records which engine the host runs, once it is reachable.
+// Podman serves the same API with a few gaps the watcher tolerates and
+// lists pod infra containers, which managed leaves out.
+func (h *host) detectEngine(ctx context.Context, session *logger.Session) {
+	h.mu.Lock()
+	known := h.status.Engine != ""
+	h.mu.Unlock()
+	if known {
+		return
+	}
+
+	engine, version, err := dockerhost.Engine(ctx, h.cli)
+	if err != nil {
+		session.Warn("Failed to detect engine: %v", err)
+		return
+	}
+	session.Info("Connected to %s %s", engine, version)
+
+	h.mu.Lock()
+	h.status.Engine = engine + " " + version
+	h.podman = dockerhost.IsPodman(engine)
+	h.mu.Unlock()
+}
+
+// managed reports whether c can be a backup target. Verification
+// containers never are, and neither are the infra containers of Podman
+// pods: labels given to a pod end up on them, but they only hold the pod's
+// namespaces.
+func (h *host) managed(c types.Container) bool {
+	if verify.IsVerification(c.Labels) {
+		return false
+	}
+	h.mu.Lock()
+	podman := h.podman
+	h.mu.Unlock()
+	return !podman || !dockerhost.IsPodInfra(c.Image, c.Names)
+}
+
+// requestReconcile asks the host's reconcile loop to run soon.
+func (h *host) requestReconcile() {
+	select {
+	case h.trigger <- struct{}{}:
+	default:
+		// A reconcile is already pending and will see this change too.
+	}
+}
+
+// setConnected records whether the host was just reached, err being why not.
+func (h *host) setConnected(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if connected := err == nil; connected != h.status.Connected {
+		h.status.Connected = connected
+		h.status.Since = time.Now()
+	}
+	h.status.Error = ""
+	if err != nil {
+		h.status.Error = err.Error()
+	}
+}
+
+func (h *host) currentStatus() hostStatus {
+	h.mu.Lock()
+	status := h.status
+	h.mu.Unlock()
+
+	status.Endpoint = h.endpoint
+	status.Jobs = len(h.mgr.Jobs())
+	return status
+}
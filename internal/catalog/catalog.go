@@ -0,0 +1,287 @@
+package catalog
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+const DefaultPath = "/var/lib/docker-auto-backup/catalog.db"
+
+// ManifestSuffix is appended to a backup's object name to store its catalog
+// entry next to it, so the catalog can be rebuilt from storage.
+const ManifestSuffix = ".manifest.json"
+
+var runsBucket = []byte("runs")
+
+var ErrNotFound = errors.New("run not found")
+
+type Status string
+
+const (
+	Success Status = "success"
+	Failure Status = "failure"
+)
+
+type Destination struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Bytes int64  `json:"bytes"`
+	Error string `json:"error,omitempty"`
+}
+
+// Entry describes a single backup run.
+type Entry struct {
+	ID           string        `json:"id"`
+	Job          string        `json:"job"`
+	ContainerID  string        `json:"container_id"`
+	Container    string        `json:"container"`
+	Image        string        `json:"image"`
+	Provider     string        `json:"provider"`
+	Object       string        `json:"object,omitempty"`
+	Destinations []Destination `json:"destinations"`
+	Size         int64         `json:"size"`
+	Checksum     string        `json:"checksum,omitempty"`
+	StartedAt    time.Time     `json:"started_at"`
+	QueueWait    time.Duration `json:"queue_wait"`
+	Attempt      int           `json:"attempt"`
+	// FencingToken is the leader's lease token when leader election is on.
+	FencingToken uint64        `json:"fencing_token,omitempty"`
+	Duration     time.Duration `json:"duration"`
+	Status       Status        `json:"status"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// NewID returns a run ID that sorts by start time.
+func NewID(t time.Time) string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%s", t.UTC().Format("20060102-150405"), hex.EncodeToString(b))
+}
+
+type Filter struct {
+	Job    string
+	Status Status
+	// Limit caps the number of entries returned; zero means no limit.
+	Limit int
+}
+
+func (f Filter) matches(e *Entry) bool {
+	if f.Job != "" && e.Job != f.Job && e.Container != f.Job {
+		return false
+	}
+	if f.Status != "" && e.Status != f.Status {
+		return false
+	}
+	return true
+}
+
+// Catalog is a bbolt database of backup runs. The file is only held open for
+// the duration of each call so the list and show commands can read it while
+// the daemon is running.
+type Catalog struct {
+	path string
+}
+
+func Open(path string) (*Catalog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create catalog directory: %w", err)
+	}
+
+	c := &Catalog{path: path}
+	err := c.update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(runsBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Catalog) open(readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(c.path, 0644, &bolt.Options{Timeout: 5 * time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open catalog: %w", err)
+	}
+	return db, nil
+}
+
+func (c *Catalog) update(fn func(tx *bolt.Tx) error) error {
+	db, err := c.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+func (c *Catalog) view(fn func(b *bolt.Bucket) error) error {
+	db, err := c.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runsBucket)
+		if b == nil {
+			return nil
+		}
+		return fn(b)
+	})
+}
+
+// Record stores e, replacing any entry with the same ID.
+func (c *Catalog) Record(e *Entry) error {
+	if e.ID == "" {
+		e.ID = NewID(e.StartedAt)
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal catalog entry: %w", err)
+	}
+	return c.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(e.ID), data)
+	})
+}
+
+// List returns the entries matching f, newest first.
+func (c *Catalog) List(f Filter) ([]Entry, error) {
+	var entries []Entry
+	err := c.view(func(b *bolt.Bucket) error {
+		cur := b.Cursor()
+		for k, v := cur.Last(); k != nil; k, v = cur.Prev() {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return fmt.Errorf("failed to decode catalog entry %s: %w", k, err)
+			}
+			if !f.matches(&e) {
+				continue
+			}
+			entries = append(entries, e)
+			if f.Limit > 0 && len(entries) == f.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Get returns the entry with the given ID or, if unambiguous, ID prefix.
+func (c *Catalog) Get(id string) (*Entry, error) {
+	var found []byte
+	err := c.view(func(b *bolt.Bucket) error {
+		if v := b.Get([]byte(id)); v != nil {
+			found = bytes.Clone(v)
+			return nil
+		}
+		cur := b.Cursor()
+		prefix := []byte(id)
+		for k, v := cur.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cur.Next() {
+			if found != nil {
+				return fmt.Errorf("run ID %s is ambiguous", id)
+			}
+			found = bytes.Clone(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+
+	var e Entry
+	if err := json.Unmarshal(found, &e); err != nil {
+		return nil, fmt.Errorf("failed to decode catalog entry: %w", err)
+	}
+	return &e, nil
+}
+
+// Rebuild records every manifest found in storage and returns how many were
+// imported. Entries already in the catalog are overwritten with the same data.
+func (c *Catalog) Rebuild(ctx context.Context, storage models.Storage) (int, error) {
+	objects, err := storage.List(ctx, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	var names []string
+	for _, obj := range objects {
+		if strings.HasSuffix(obj.Name, ManifestSuffix) {
+			names = append(names, obj.Name)
+		}
+	}
+	sort.Strings(names)
+
+	imported := 0
+	var errs []error
+	for _, name := range names {
+		e, err := ReadManifest(ctx, storage, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := c.Record(e); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, errors.Join(errs...)
+}
+
+func ManifestName(object string) string {
+	return object + ManifestSuffix
+}
+
+// IsMetadata reports whether name is a file stored alongside backups rather
+// than a backup itself.
+func IsMetadata(name string) bool {
+	return strings.HasSuffix(name, ManifestSuffix)
+}
+
+func WriteManifest(ctx context.Context, storage models.Storage, e *Entry) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := storage.Put(ctx, ManifestName(e.Object), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+func ReadManifest(ctx context.Context, storage models.Storage, name string) (*Entry, error) {
+	r, err := storage.Get(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", name, err)
+	}
+	defer r.Close()
+
+	var e Entry
+	if err := json.NewDecoder(r).Decode(&e); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest %s: %w", name, err)
+	}
+	if e.ID == "" {
+		return nil, fmt.Errorf("manifest %s has no run ID", name)
+	}
+	return &e, nil
+}
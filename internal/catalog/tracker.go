@@ -0,0 +1,59 @@
+package catalog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/bytekai/docker-auto-backup/internal/models"
+)
+
+// Tracker wraps a storage and records the name, size and sha256 checksum of
+// the object written through it.
+type Tracker struct {
+	models.Storage
+
+	mu     sync.Mutex
+	object string
+	size   int64
+	sum    string
+}
+
+func Track(s models.Storage) *Tracker {
+	return &Tracker{Storage: s}
+}
+
+func (t *Tracker) Put(ctx context.Context, name string, file io.Reader) error {
+	r := &hashingReader{r: file, h: sha256.New()}
+	err := t.Storage.Put(ctx, name, r)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.object = name
+	t.size = r.n
+	t.sum = hex.EncodeToString(r.h.Sum(nil))
+	return err
+}
+
+// Written returns the object, size and checksum of the last Put.
+func (t *Tracker) Written() (object string, size int64, checksum string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.object, t.size, t.sum
+}
+
+type hashingReader struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	r.n += int64(n)
+	return n, err
+}
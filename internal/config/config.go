@@ -0,0 +1,259 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultPath = "/etc/docker-auto-backup/config.yml"
+
+// Config is the daemon wide configuration. Every section is flattened into
+// the same dotted keys used by backup.* labels, so a storage definition
+//
+//	storages:
+//	  offsite:
+//	    type: s3
+//	    bucket: backups
+//
+// is equivalent to the labels backup.storage.offsite.type and
+// backup.storage.offsite.bucket.
+type Config struct {
+	Defaults    map[string]string
+	Storages    map[string]map[string]string
+	Notifiers   map[string]map[string]string
+	Concurrency Concurrency
+	// ShutdownGrace is how long running backups may take to finish after
+	// SIGTERM before they are cancelled.
+	ShutdownGrace time.Duration
+	// ReconcileInterval is how often jobs are resynced with all containers
+	// besides on container events. Zero only reconciles on events.
+	ReconcileInterval time.Duration
+	// Hosts are the Docker engines to manage. Without any, the daemon
+	// manages the engine configured by the DOCKER_* environment.
+	Hosts []Host
+	// MetricsAddr is the address to serve /metrics and /health on, if any.
+	MetricsAddr string
+	// LeaderElection lets only one of several redundant agents schedule
+	// jobs. Nil disables it.
+	LeaderElection *LeaderElection
+}
+
+// DefaultLeaseTTL is how long a leader's lease lasts without renewal,
+// bounding how long a crashed leader's jobs go unscheduled.
+const DefaultLeaseTTL = 30 * time.Second
+
+// LeaderElection configures the lease agents compete for.
+type LeaderElection struct {
+	// Storage names the entry in storages that holds the lease object.
+	Storage string `yaml:"storage"`
+	// Key is the lease object's name; empty uses the default.
+	Key string        `yaml:"key"`
+	TTL time.Duration `yaml:"ttl"`
+	// ID identifies this agent; empty derives one from the hostname.
+	ID string `yaml:"id"`
+}
+
+// Host is a Docker engine reachable at Endpoint, e.g. unix:///var/run/docker.sock,
+// tcp://10.0.0.5:2376 or ssh://backup@10.0.0.6. Its name namespaces the jobs
+// of its containers.
+type Host struct {
+	Name     string `yaml:"name"`
+	Endpoint string `yaml:"endpoint"`
+	TLS      *TLS   `yaml:"tls"`
+}
+
+// TLS holds the files to authenticate to a tcp endpoint with.
+type TLS struct {
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// DefaultMaxConcurrent is how many backups run at once unless configured.
+const DefaultMaxConcurrent = 4
+
+// DefaultShutdownGrace should stay below the container's stop timeout.
+const DefaultShutdownGrace = 5 * time.Minute
+
+// DefaultReconcileInterval catches changes whose events were missed.
+const DefaultReconcileInterval = time.Minute
+
+// Concurrency limits how many backups and verifications run at the same
+// time across all jobs. Zero means unlimited.
+type Concurrency struct {
+	Max int `yaml:"max"`
+	// PerDestination limits the runs writing to the same named storage.
+	PerDestination int `yaml:"per_destination"`
+}
+
+type file struct {
+	Defaults      map[string]any            `yaml:"defaults"`
+	Storages      map[string]map[string]any `yaml:"storages"`
+	Notifiers     map[string]map[string]any `yaml:"notifiers"`
+	Concurrency   Concurrency               `yaml:"concurrency"`
+	ShutdownGrace time.Duration             `yaml:"shutdown_grace"`
+	Reconcile     time.Duration             `yaml:"reconcile_interval"`
+	Hosts         []Host                    `yaml:"hosts"`
+	MetricsAddr   string                    `yaml:"metrics_addr"`
+	Leader        *LeaderElection           `yaml:"leader_election"`
+}
+
+func New() *Config {
+	return &Config{
+		Defaults:          make(map[string]string),
+		Storages:          make(map[string]map[string]string),
+		Notifiers:         make(map[string]map[string]string),
+		Concurrency:       Concurrency{Max: DefaultMaxConcurrent},
+		ShutdownGrace:     DefaultShutdownGrace,
+		ReconcileInterval: DefaultReconcileInterval,
+	}
+}
+
+// Load reads the config file at path. A missing file yields an empty config
+// unless required is set.
+func Load(path string, required bool) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !required {
+			return New(), nil
+		}
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Config, error) {
+	f := file{
+		Concurrency:   Concurrency{Max: DefaultMaxConcurrent},
+		ShutdownGrace: DefaultShutdownGrace,
+		Reconcile:     DefaultReconcileInterval,
+	}
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	c := New()
+	flatten("", f.Defaults, c.Defaults)
+	for name, values := range f.Storages {
+		c.Storages[name] = make(map[string]string)
+		flatten("", values, c.Storages[name])
+	}
+	for name, values := range f.Notifiers {
+		c.Notifiers[name] = make(map[string]string)
+		flatten("", values, c.Notifiers[name])
+	}
+	if f.Concurrency.Max < 0 || f.Concurrency.PerDestination < 0 {
+		return nil, errors.New("concurrency limits must not be negative")
+	}
+	c.Concurrency = f.Concurrency
+
+	if f.ShutdownGrace < 0 {
+		return nil, errors.New("shutdown grace period must not be negative")
+	}
+	c.ShutdownGrace = f.ShutdownGrace
+
+	if f.Reconcile < 0 {
+		return nil, errors.New("reconcile interval must not be negative")
+	}
+	c.ReconcileInterval = f.Reconcile
+
+	names := make(map[string]bool)
+	for _, h := range f.Hosts {
+		switch {
+		case h.Name == "" || strings.ContainsAny(h.Name, "/ "):
+			return nil, fmt.Errorf("invalid host name %q", h.Name)
+		case names[h.Name]:
+			return nil, fmt.Errorf("duplicate host %s", h.Name)
+		case h.Endpoint == "":
+			return nil, fmt.Errorf("host %s has no endpoint", h.Name)
+		}
+		names[h.Name] = true
+	}
+	c.Hosts = f.Hosts
+	c.MetricsAddr = f.MetricsAddr
+
+	if le := f.Leader; le != nil {
+		if le.Storage == "" {
+			return nil, errors.New("leader election needs a storage")
+		}
+		if _, ok := c.Storages[le.Storage]; !ok {
+			return nil, fmt.Errorf("leader election storage %s is not defined in storages", le.Storage)
+		}
+		if le.TTL == 0 {
+			le.TTL = DefaultLeaseTTL
+		}
+		if le.TTL < 3*time.Second {
+			return nil, errors.New("leader election ttl must be at least 3s")
+		}
+		c.LeaderElection = le
+	}
+
+	return c, nil
+}
+
+// Merge layers container labels over the global defaults and named storage
+// definitions. Labels always win, so a container can override single fields
+// of a shared storage target.
+func (c *Config) Merge(labels map[string]string) map[string]string {
+	merged := make(map[string]string, len(c.Defaults)+len(labels))
+	for key, value := range c.Defaults {
+		merged[key] = value
+	}
+	for name, values := range c.Storages {
+		for key, value := range values {
+			merged["storage."+name+"."+key] = value
+		}
+	}
+	for key, value := range labels {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// Notifier returns the settings of a named notifier.
+func (c *Config) Notifier(name string) (map[string]string, bool) {
+	values, ok := c.Notifiers[name]
+	return values, ok
+}
+
+func (c *Config) StorageNames() []string {
+	names := make([]string, 0, len(c.Storages))
+	for name := range c.Storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func flatten(prefix string, values map[string]any, out map[string]string) {
+	for key, value := range values {
+		full := key
+		if prefix != "" {
+			full = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]any:
+			flatten(full, v, out)
+		case []any:
+			parts := make([]string, 0, len(v))
+			for _, item := range v {
+				parts = append(parts, fmt.Sprint(item))
+			}
+			out[full] = strings.Join(parts, ",")
+		case nil:
+			out[full] = ""
+		default:
+			out[full] = fmt.Sprint(v)
+		}
+	}
+}
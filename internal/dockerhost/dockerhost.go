@@ -0,0 +1,125 @@
+package dockerhost
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os/exec"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/config"
+	"github.com/docker/docker/client"
+)
+
+// NewClient returns a client for the Docker engine of h. An empty endpoint
+// uses the DOCKER_* environment, falling back to a Podman socket if there
+// is no Docker socket. ssh endpoints run `docker system dial-stdio`
+// on the remote host through the ssh binary, like the docker CLI does.
+func NewClient(h config.Host) (*client.Client, error) {
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+	if h.Endpoint == "" {
+		h.Endpoint = Detect()
+	}
+	if h.Endpoint == "" {
+		return client.NewClientWithOpts(append(opts, client.FromEnv)...)
+	}
+
+	u, err := url.Parse(h.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", h.Endpoint, err)
+	}
+
+	switch u.Scheme {
+	case "unix", "npipe":
+		opts = append(opts, client.WithHost(h.Endpoint))
+	case "tcp":
+		opts = append(opts, client.WithHost(h.Endpoint))
+		if h.TLS != nil {
+			opts = append(opts, client.WithTLSClientConfig(h.TLS.CAFile, h.TLS.CertFile, h.TLS.KeyFile))
+		}
+	case "ssh":
+		if u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q: missing host", h.Endpoint)
+		}
+		opts = append(opts,
+			// The host only names the daemon in requests; connections go
+			// through ssh.
+			client.WithHost("http://docker.example.com"),
+			client.WithDialContext(func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialSSH(ctx, u)
+			}),
+		)
+	default:
+		return nil, fmt.Errorf("unsupported endpoint scheme %q", u.Scheme)
+	}
+
+	return client.NewClientWithOpts(opts...)
+}
+
+func dialSSH(ctx context.Context, u *url.URL) (net.Conn, error) {
+	args := []string{"-o", "BatchMode=yes"}
+	if u.User != nil {
+		args = append(args, "-l", u.User.Username())
+	}
+	if port := u.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	args = append(args, "--", u.Hostname(), "docker", "system", "dial-stdio")
+
+	// The connection outlives ctx, which only bounds dialing.
+	cmd := exec.Command("ssh", args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run ssh: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, err
+	}
+
+	return &cmdConn{cmd: cmd, stdin: stdin, stdout: stdout, addr: u.Host}, nil
+}
+
+// cmdConn is a connection over the stdin and stdout of a command.
+type cmdConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	addr   string
+}
+
+func (c *cmdConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *cmdConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+func (c *cmdConn) Close() error {
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return nil
+}
+
+// CloseWrite lets hijacked exec streams signal the end of their input.
+func (c *cmdConn) CloseWrite() error { return c.stdin.Close() }
+
+func (c *cmdConn) LocalAddr() net.Addr  { return addr("stdio") }
+func (c *cmdConn) RemoteAddr() net.Addr { return addr(c.addr) }
+
+// Deadlines aren't supported; requests are bounded by their contexts.
+func (c *cmdConn) SetDeadline(time.Time) error      { return nil }
+func (c *cmdConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *cmdConn) SetWriteDeadline(time.Time) error { return nil }
+
+type addr string
+
+func (a addr) Network() string { return "ssh" }
+func (a addr) String() string  { return string(a) }
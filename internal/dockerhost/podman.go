@@ -0,0 +1,90 @@
+package dockerhost
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// DockerSocket is where the Docker daemon listens by default.
+const DockerSocket = "/var/run/docker.sock"
+
+// PodmanSockets returns where Podman serves its Docker-compatible API, the
+// rootless sockets of the current user first.
+func PodmanSockets() []string {
+	var sockets []string
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sockets = append(sockets, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	sockets = append(sockets,
+		fmt.Sprintf("/run/user/%d/podman/podman.sock", os.Getuid()),
+		"/run/podman/podman.sock",
+	)
+	return sockets
+}
+
+// Detect returns the endpoint to use when none is configured. DOCKER_HOST
+// and the Docker socket take precedence; otherwise the first Podman socket
+// found is used. An empty result leaves the choice to the environment.
+func Detect() string {
+	if os.Getenv("DOCKER_HOST") != "" {
+		return ""
+	}
+	if isSocket(DockerSocket) {
+		return ""
+	}
+	for _, path := range PodmanSockets() {
+		if isSocket(path) {
+			return "unix://" + path
+		}
+	}
+	return ""
+}
+
+func isSocket(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// Engine returns the name and version of the engine cli talks to, e.g.
+// "Docker Engine" or "Podman Engine".
+func Engine(ctx context.Context, cli *client.Client) (string, string, error) {
+	v, err := cli.ServerVersion(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get server version: %w", err)
+	}
+	for _, c := range v.Components {
+		if strings.HasSuffix(c.Name, "Engine") {
+			return c.Name, c.Version, nil
+		}
+	}
+	return v.Platform.Name, v.Version, nil
+}
+
+// IsPodman reports whether engine, as returned by Engine, is Podman.
+func IsPodman(engine string) bool {
+	return strings.Contains(strings.ToLower(engine), "podman")
+}
+
+// IsPodInfra reports whether a container listed by Podman is the infra
+// container of a pod, going by its image and names. Podman names them
+// <pod ID>-infra and runs them from a pause image unless told otherwise.
+func IsPodInfra(image string, names []string) bool {
+	repo, _, _ := strings.Cut(image, "@")
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo = repo[:i]
+	}
+	if base := repo[strings.LastIndex(repo, "/")+1:]; base == "podman-pause" || base == "pause" {
+		return true
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, "-infra") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package lease
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/models"
+)
+
+// DefaultKey is the name of the lease object in storage.
+const DefaultKey = "docker-auto-backup.lease"
+
+// ErrNotLeader is returned by Check when the lease is held by someone else
+// or under a newer token.
+var ErrNotLeader = errors.New("not the leader")
+
+// Lease is the content of the lease object.
+type Lease struct {
+	Holder string `json:"holder"`
+	// Token grows with every change of holder. Work started under an
+	// older token is from a deposed leader.
+	Token     uint64    `json:"token"`
+	RenewedAt time.Time `json:"renewed_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Status is an elector's view of the election.
+type Status struct {
+	ID      string `json:"id"`
+	Leading bool   `json:"leading"`
+	// Leader is the holder of the last lease seen, if it is still valid.
+	Leader    string    `json:"leader,omitempty"`
+	Token     uint64    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Elector competes for a lease stored as an object in shared storage.
+//
+// Storage backends don't offer compare-and-swap, so acquiring writes the
+// lease, waits briefly and reads it back: of several agents racing for an
+// expired lease, only the last writer sees itself as holder. Leases expire
+// by wall clock, so agents need synchronized clocks. Check guards against
+// the remaining races by confirming the lease before work starts and
+// again before its results are published.
+type Elector struct {
+	storage models.Storage
+	key     string
+	id      string
+	ttl     time.Duration
+
+	mu      sync.Mutex
+	leading bool
+	token   uint64
+	renewed time.Time
+	seen    *Lease
+	err     error
+}
+
+// New returns an elector identified by id holding leases for ttl.
+func New(storage models.Storage, key, id string, ttl time.Duration) *Elector {
+	if key == "" {
+		key = DefaultKey
+	}
+	return &Elector{storage: storage, key: key, id: id, ttl: ttl}
+}
+
+// Run competes for the lease until ctx is done, renewing it while leading.
+// onChange is called whenever leadership is gained or lost.
+func (e *Elector) Run(ctx context.Context, onChange func(leading bool, token uint64)) {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		was, _ := e.Leading()
+		err := e.tryAcquire(ctx)
+		if err != nil {
+			e.mu.Lock()
+			e.err = err
+			// Without a confirmed renewal the lease may have passed on.
+			if e.leading && time.Since(e.renewed) >= e.ttl {
+				e.leading = false
+			}
+			e.mu.Unlock()
+		}
+
+		if leading, token := e.Leading(); leading != was && onChange != nil {
+			onChange(leading, token)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *Elector) tryAcquire(ctx context.Context) error {
+	cur, err := e.read(ctx)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	leading := e.leading
+	e.seen = cur
+	e.err = nil
+	e.mu.Unlock()
+
+	now := time.Now()
+	if cur != nil && cur.Holder != e.id && now.Before(cur.ExpiresAt) {
+		e.setLeading(false, 0)
+		return nil
+	}
+
+	var token uint64 = 1
+	if cur != nil {
+		token = cur.Token
+		// A new term, even for a restarted holder, gets a new token.
+		if cur.Holder != e.id || !leading {
+			token++
+		}
+	}
+
+	next := &Lease{Holder: e.id, Token: token, RenewedAt: now, ExpiresAt: now.Add(e.ttl)}
+	if err := e.write(ctx, next); err != nil {
+		return err
+	}
+
+	if !leading {
+		// Let competing writes land, then see who won.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.ttl / 10):
+		}
+		cur, err = e.read(ctx)
+		if err != nil {
+			return err
+		}
+		e.mu.Lock()
+		e.seen = cur
+		e.mu.Unlock()
+		if cur == nil || cur.Holder != e.id || cur.Token != token {
+			e.setLeading(false, 0)
+			return nil
+		}
+	}
+
+	e.mu.Lock()
+	e.seen = next
+	e.renewed = now
+	e.mu.Unlock()
+	e.setLeading(true, token)
+	return nil
+}
+
+func (e *Elector) setLeading(leading bool, token uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leading = leading
+	e.token = token
+}
+
+// Leading reports whether this elector holds the lease and its token.
+func (e *Elector) Leading() (bool, uint64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leading, e.token
+}
+
+// Check confirms that this elector still holds the lease under the token it
+// acquired it with and returns that token.
+func (e *Elector) Check(ctx context.Context) (uint64, error) {
+	leading, token := e.Leading()
+	if !leading {
+		return 0, ErrNotLeader
+	}
+
+	cur, err := e.read(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to confirm lease: %w", err)
+	}
+	if cur == nil || cur.Holder != e.id || cur.Token != token || time.Now().After(cur.ExpiresAt) {
+		return 0, ErrNotLeader
+	}
+	return token, nil
+}
+
+// Release gives up the lease if this elector holds it, so another agent
+// can take over without waiting for it to expire.
+func (e *Elector) Release(ctx context.Context) error {
+	leading, token := e.Leading()
+	if !leading {
+		return nil
+	}
+	e.setLeading(false, 0)
+
+	cur, err := e.read(ctx)
+	if err != nil {
+		return err
+	}
+	if cur == nil || cur.Holder != e.id || cur.Token != token {
+		return nil
+	}
+
+	// Keep the token so the next holder's is newer.
+	now := time.Now()
+	return e.write(ctx, &Lease{Holder: e.id, Token: token, RenewedAt: now, ExpiresAt: now})
+}
+
+// Status returns the elector's view of the election.
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	s := Status{ID: e.id, Leading: e.leading, Token: e.token}
+	if e.seen != nil && time.Now().Before(e.seen.ExpiresAt) {
+		s.Leader = e.seen.Holder
+		s.Token = e.seen.Token
+		s.ExpiresAt = e.seen.ExpiresAt
+	}
+	if e.err != nil {
+		s.Error = e.err.Error()
+	}
+	return s
+}
+
+// read returns the current lease, or nil if there is none. A missing object
+// is told apart from a failed read by listing, as storages report missing
+// objects differently.
+func (e *Elector) read(ctx context.Context) (*Lease, error) {
+	objects, err := e.storage.List(ctx, e.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list lease: %w", err)
+	}
+	found := false
+	for _, obj := range objects {
+		if obj.Name == e.key {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	r, err := e.storage.Get(ctx, e.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lease: %w", err)
+	}
+	defer r.Close()
+
+	var l Lease
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return nil, fmt.Errorf("failed to decode lease: %w", err)
+	}
+	return &l, nil
+}
+
+func (e *Elector) write(ctx context.Context, l *Lease) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lease: %w", err)
+	}
+	if err := e.storage.Put(ctx, e.key, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("failed to write lease: %w", err)
+	}
+	return nil
+}
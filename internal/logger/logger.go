@@ -1,9 +1,13 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,23 +21,97 @@ const (
 	ERROR
 )
 
+var levelNames = [...]string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// ParseLevel parses a level name such as "info", case-insensitively.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return WARN, nil
+	}
+	return 0, fmt.Errorf("invalid log level %q", s)
+}
+
+func (l Level) slog() slog.Level {
+	switch l {
+	case DEBUG:
+		return slog.LevelDebug
+	case WARN:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Format selects how log lines are written.
+type Format int
+
+const (
+	// TEXT writes "<time> [<LEVEL>] <prefix><message> key=value...".
+	TEXT Format = iota
+	// JSON writes one object per line with time, level, msg, the session
+	// prefix and all fields, as produced by slog.JSONHandler.
+	JSON
+)
+
+// ParseFormat parses "text" or "json".
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "text":
+		return TEXT, nil
+	case "json":
+		return JSON, nil
+	default:
+		return 0, fmt.Errorf("invalid log format %q", s)
+	}
+}
+
 type Logger struct {
-	out   io.Writer
-	level Level
-	mu    sync.Mutex
+	out    io.Writer
+	level  slog.LevelVar
+	format Format
+	mu     sync.Mutex
 }
 
 type Session struct {
 	logger *Logger
 	prefix string
+	fields []slog.Attr
 	mu     sync.Mutex
 }
 
 func New(level Level) *Logger {
-	return &Logger{
-		out:   os.Stdout,
-		level: level,
+	l := &Logger{out: os.Stdout}
+	l.level.Set(level.slog())
+	return l
+}
+
+// FromEnv returns a logger configured by LOG_LEVEL and LOG_FORMAT, using
+// defaultLevel and text when they are unset.
+func FromEnv(defaultLevel Level) (*Logger, error) {
+	level := defaultLevel
+	if s := os.Getenv("LOG_LEVEL"); s != "" {
+		var err error
+		if level, err = ParseLevel(s); err != nil {
+			return nil, err
+		}
 	}
+
+	l := New(level)
+	if s := os.Getenv("LOG_FORMAT"); s != "" {
+		format, err := ParseFormat(s)
+		if err != nil {
+			return nil, err
+		}
+		l.SetFormat(format)
+	}
+	return l, nil
 }
 
 func (l *Logger) SetOutput(w io.Writer) {
@@ -42,6 +120,27 @@ func (l *Logger) SetOutput(w io.Writer) {
 	l.out = w
 }
 
+func (l *Logger) SetLevel(level Level) {
+	l.level.Set(level.slog())
+}
+
+func (l *Logger) SetFormat(format Format) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.format = format
+}
+
+// Handler returns a slog handler writing through the logger, so records
+// logged with log/slog end up in the same output and format.
+func (l *Logger) Handler() slog.Handler {
+	return &handler{logger: l}
+}
+
+// Slog returns a slog.Logger writing through the logger.
+func (l *Logger) Slog() *slog.Logger {
+	return slog.New(l.Handler())
+}
+
 func (l *Logger) NewSession(prefix string) *Session {
 	return &Session{
 		logger: l,
@@ -49,19 +148,33 @@ func (l *Logger) NewSession(prefix string) *Session {
 	}
 }
 
+// With returns a session with the same prefix and additional fields, given
+// as alternating keys and values like slog.Logger.With.
+func (s *Session) With(args ...any) *Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fields := append([]slog.Attr(nil), s.fields...)
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = append(fields, a)
+		return true
+	})
+	return &Session{logger: s.logger, prefix: s.prefix, fields: fields}
+}
+
 func (s *Session) log(level Level, format string, args ...interface{}) {
-	if level < s.logger.level {
+	if level.slog() < s.logger.level.Level() {
 		return
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	levelStr := [...]string{"DEBUG", "INFO", "WARN", "ERROR"}[level]
-
-	msg := fmt.Sprintf(format, args...)
-	fmt.Fprintf(s.logger.out, "%s [%s] %s%s\n", timestamp, levelStr, s.prefix, msg)
+	r := slog.NewRecord(time.Now(), level.slog(), fmt.Sprintf(format, args...), 0)
+	r.AddAttrs(s.fields...)
+	s.logger.write(s.prefix, r)
 }
 
 func (s *Session) Debug(format string, args ...interface{}) {
@@ -85,3 +198,124 @@ func (s *Session) SetPrefix(prefix string) {
 	defer s.mu.Unlock()
 	s.prefix = prefix
 }
+
+// write formats r, logged under prefix, to the output.
+func (l *Logger) write(prefix string, r slog.Record) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.format == JSON {
+		if prefix = strings.TrimSpace(prefix); prefix != "" {
+			r.AddAttrs(slog.String("prefix", prefix))
+		}
+		// The handler only lives for this call, so it writes to the
+		// current output.
+		slog.NewJSONHandler(l.out, &slog.HandlerOptions{Level: &l.level}).Handle(context.Background(), r)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(r.Time.Format("2006-01-02 15:04:05"))
+	b.WriteString(" [")
+	b.WriteString(levelName(r.Level))
+	b.WriteString("] ")
+	b.WriteString(prefix)
+	b.WriteString(r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(&b, "", a)
+		return true
+	})
+	b.WriteByte('\n')
+	io.WriteString(l.out, b.String())
+}
+
+func levelName(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "DEBUG"
+	case level < slog.LevelWarn:
+		return "INFO"
+	case level < slog.LevelError:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+func writeAttr(b *strings.Builder, group string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+
+	key := a.Key
+	if group != "" {
+		key = group + "." + key
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		for _, ga := range a.Value.Group() {
+			writeAttr(b, key, ga)
+		}
+		return
+	}
+
+	value := a.Value.String()
+	if value == "" || strings.ContainsAny(value, " \"=\n\t") {
+		value = strconv.Quote(value)
+	}
+	b.WriteByte(' ')
+	b.WriteString(key)
+	b.WriteByte('=')
+	b.WriteString(value)
+}
+
+// handler adapts the logger to slog.
+type handler struct {
+	logger *Logger
+	attrs  []slog.Attr
+	group  string
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.logger.level.Level()
+}
+
+func (h *handler) Handle(_ context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, r.Message, r.PC)
+	out.AddAttrs(h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.qualify(a))
+		return true
+	})
+	h.logger.write("", out)
+	return nil
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := &handler{logger: h.logger, group: h.group}
+	next.attrs = append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		next.attrs = append(next.attrs, h.qualify(a))
+	}
+	return next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	group := name
+	if h.group != "" {
+		group = h.group + "." + name
+	}
+	return &handler{logger: h.logger, attrs: h.attrs, group: group}
+}
+
+// qualify prefixes the key of a with the handler's group.
+func (h *handler) qualify(a slog.Attr) slog.Attr {
+	if h.group == "" {
+		return a
+	}
+	a.Key = h.group + "." + a.Key
+	return a
+}
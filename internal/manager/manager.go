@@ -1,42 +1,133 @@
 package manager
 
 import (
+	"context"
+	"fmt"
 	"sync"
 
 	"github.com/bytekai/docker-auto-backup/internal/logger"
 	"github.com/bytekai/docker-auto-backup/internal/scheduler"
 )
 
+// Job identifies what a job's schedulers were created from.
+type Job struct {
+	ContainerID string
+	// Hash summarizes the job's config; a job whose hash is unchanged
+	// doesn't need new schedulers.
+	Hash string
+}
+
+type entry struct {
+	Job
+	schedulers []scheduler.Scheduler
+}
+
+// Manager tracks the schedulers of each job. Jobs are keyed by their stable
+// name so a recreated container takes over the job of the one it replaces.
 type Manager struct {
-	schedulers map[string]scheduler.Scheduler
-	mu         sync.RWMutex
-	logger     *logger.Logger
+	jobs   map[string]entry
+	mu     sync.RWMutex
+	logger *logger.Logger
 }
 
 func New(logger *logger.Logger) *Manager {
 	return &Manager{
-		schedulers: make(map[string]scheduler.Scheduler),
-		logger:     logger,
+		jobs:   make(map[string]entry),
+		logger: logger,
 	}
 }
 
-func (m *Manager) AddScheduler(containerID string, scheduler scheduler.Scheduler) {
+// AddScheduler registers the schedulers of the named job and starts them,
+// replacing any it had before. A run of the replaced schedulers is cancelled
+// and waited for first, so runs of the job never overlap.
+func (m *Manager) AddScheduler(name string, job Job, schedulers ...scheduler.Scheduler) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	replaced := m.jobs[name].schedulers
+	m.jobs[name] = entry{Job: job, schedulers: schedulers}
+	m.mu.Unlock()
 
-	if existing, exists := m.schedulers[containerID]; exists {
-		existing.Stop()
+	var stopped []context.Context
+	for _, existing := range replaced {
+		stopped = append(stopped, existing.Stop())
+		existing.Cancel()
+	}
+	for _, s := range stopped {
+		<-s.Done()
 	}
 
-	m.schedulers[containerID] = scheduler
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The job may have been removed or replaced again while waiting.
+	if current := m.jobs[name].schedulers; len(schedulers) > 0 && (len(current) == 0 || current[0] != schedulers[0]) {
+		return nil
+	}
+	for _, s := range schedulers {
+		if err := s.Start(); err != nil {
+			return fmt.Errorf("failed to start scheduler: %w", err)
+		}
+	}
+	return nil
 }
 
-func (m *Manager) RemoveScheduler(containerID string) {
+// RemoveScheduler stops and removes a job if it is still run by containerID.
+// A container that dies after its replacement started leaves the job alone.
+// It reports whether the job was removed.
+func (m *Manager) RemoveScheduler(job, containerID string) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if scheduler, exists := m.schedulers[containerID]; exists {
+	e, exists := m.jobs[job]
+	if !exists || e.ContainerID != containerID {
+		return false
+	}
+
+	for _, scheduler := range e.schedulers {
 		scheduler.Stop()
-		delete(m.schedulers, containerID)
 	}
+	delete(m.jobs, job)
+	return true
+}
+
+// Jobs returns all jobs by name.
+func (m *Manager) Jobs() map[string]Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := make(map[string]Job, len(m.jobs))
+	for name, e := range m.jobs {
+		jobs[name] = e.Job
+	}
+	return jobs
+}
+
+// ContainerID returns the container currently running job.
+func (m *Manager) ContainerID(job string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, exists := m.jobs[job]
+	return e.ContainerID, exists
+}
+
+// StopAll stops every scheduler and forgets all jobs. The returned context
+// is done once all running tasks have finished.
+func (m *Manager) StopAll() context.Context {
+	m.mu.Lock()
+	var stopped []context.Context
+	for job, e := range m.jobs {
+		for _, scheduler := range e.schedulers {
+			stopped = append(stopped, scheduler.Stop())
+		}
+		delete(m.jobs, job)
+	}
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for _, s := range stopped {
+			<-s.Done()
+		}
+		cancel()
+	}()
+	return ctx
 }
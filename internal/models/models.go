@@ -3,9 +3,18 @@ package models
 import (
 	"context"
 	"io"
+	"time"
 )
 
+type Object struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
 type Storage interface {
 	Put(ctx context.Context, name string, file io.Reader) error
 	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	List(ctx context.Context, prefix string) ([]Object, error)
+	Delete(ctx context.Context, name string) error
 }
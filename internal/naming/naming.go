@@ -0,0 +1,122 @@
+package naming
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate groups backups by job so containers sharing a destination
+// don't overwrite each other.
+const DefaultTemplate = `{{.Job}}/backup_{{.Timestamp}}.{{.Ext}}`
+
+// TimestampFormat is the layout of the Timestamp variable.
+const TimestampFormat = "20060102_150405"
+
+// Vars are the variables available to naming templates.
+type Vars struct {
+	// Job is the stable name of the backup job.
+	Job string
+	// Name is the container name.
+	Name     string
+	Project  string
+	Service  string
+	Provider string
+	// Hostname is the name of the Docker host the container runs on.
+	Hostname  string
+	Time      time.Time
+	Timestamp string
+	Ext       string
+}
+
+// Namer renders object names for one job.
+type Namer struct {
+	tmpl *template.Template
+	vars Vars
+	loc  *time.Location
+}
+
+// Parse checks that text is a usable naming template.
+func Parse(text string) (*template.Template, error) {
+	tmpl, err := template.New("naming").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid naming template: %w", err)
+	}
+
+	sample := Vars{
+		Job:      "job",
+		Name:     "name",
+		Project:  "project",
+		Service:  "service",
+		Provider: "provider",
+		Hostname: "host",
+		Ext:      "ext",
+	}
+	if _, err := render(tmpl, sample, time.Now()); err != nil {
+		return nil, fmt.Errorf("invalid naming template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// New returns a Namer rendering text with vars. Times are converted to loc
+// before rendering; a nil loc keeps them as given.
+func New(text string, vars Vars, loc *time.Location) (*Namer, error) {
+	if text == "" {
+		text = DefaultTemplate
+	}
+	tmpl, err := Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Namer{tmpl: tmpl, vars: vars, loc: loc}, nil
+}
+
+// Name returns the object name of a backup with extension ext taken at t.
+func (n *Namer) Name(t time.Time, ext string) (string, error) {
+	if n.loc != nil {
+		t = t.In(n.loc)
+	}
+	vars := n.vars
+	vars.Ext = ext
+	return render(n.tmpl, vars, t)
+}
+
+// Prefix returns the part of the job's object names that doesn't depend on
+// the backup time, up to the last slash. Listing it finds all of the job's
+// backups and as few others as the template allows.
+func (n *Namer) Prefix(ext string) string {
+	a, errA := n.Name(time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC), ext)
+	b, errB := n.Name(time.Date(2099, time.December, 31, 23, 59, 59, 0, time.UTC), ext)
+	if errA != nil || errB != nil {
+		return ""
+	}
+
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:strings.LastIndex(a[:i], "/")+1]
+}
+
+func render(tmpl *template.Template, vars Vars, t time.Time) (string, error) {
+	vars.Time = t
+	vars.Timestamp = t.Format(TimestampFormat)
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+
+	name := strings.TrimLeft(path.Clean("/"+strings.TrimSpace(buf.String())), "/")
+	if name == "" {
+		return "", errors.New("naming template produced an empty name")
+	}
+	if strings.HasSuffix(buf.String(), "/") {
+		return "", fmt.Errorf("naming template produced a directory: %s", buf.String())
+	}
+	return name, nil
+}
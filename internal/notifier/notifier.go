@@ -0,0 +1,115 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/secret"
+)
+
+type Status string
+
+const (
+	Success Status = "success"
+	Failure Status = "failure"
+)
+
+type Event struct {
+	Job       string    `json:"job"`
+	Container string    `json:"container"`
+	Provider  string    `json:"provider"`
+	Status    Status    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+type Config struct {
+	Name string
+	Type string
+	// On is "failure" (default) or "always".
+	On      string
+	URL     secret.String
+	Headers map[string]secret.String
+}
+
+func (c Config) Wants(status Status) bool {
+	return status == Failure || c.On == "always"
+}
+
+func New(c Config) (Notifier, error) {
+	switch c.On {
+	case "", "failure", "always":
+	default:
+		return nil, fmt.Errorf("notifier %s: invalid trigger: %s", c.Name, c.On)
+	}
+
+	switch c.Type {
+	case "webhook":
+		if c.URL == "" {
+			return nil, fmt.Errorf("notifier %s: webhook URL cannot be empty", c.Name)
+		}
+		return &WebhookNotifier{config: c, client: &http.Client{Timeout: 30 * time.Second}}, nil
+	default:
+		return nil, fmt.Errorf("notifier %s: unsupported type: %s", c.Name, c.Type)
+	}
+}
+
+// ParseConfig builds a notifier config from flattened settings such as
+// {"type": "webhook", "url": "...", "headers.Authorization": "..."}.
+func ParseConfig(name string, values map[string]string) Config {
+	c := Config{
+		Name:    name,
+		Type:    values["type"],
+		On:      values["on"],
+		URL:     secret.String(values["url"]),
+		Headers: make(map[string]secret.String),
+	}
+	for key, value := range values {
+		if header, ok := strings.CutPrefix(key, "headers."); ok {
+			c.Headers[header] = secret.String(value)
+		}
+	}
+	return c
+}
+
+type WebhookNotifier struct {
+	config Config
+	client *http.Client
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.config.URL.Value(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range n.config.Headers {
+		req.Header.Set(key, value.Value())
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
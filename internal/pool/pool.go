@@ -0,0 +1,210 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned for runs that were waiting when the pool closed.
+var ErrClosed = errors.New("pool is closed")
+
+// Request describes a run waiting for a slot.
+type Request struct {
+	Job string
+	// Priority orders waiting runs; higher runs first, equal ones in the
+	// order they were queued.
+	Priority int
+	// Destinations are the named storages the run writes to.
+	Destinations []string
+}
+
+// Stats is a snapshot of the pool's activity.
+type Stats struct {
+	Running     int           `json:"running"`
+	Queued      int           `json:"queued"`
+	Started     int64         `json:"started"`
+	TotalWait   time.Duration `json:"total_wait"`
+	MaxWait     time.Duration `json:"max_wait"`
+	LastWait    time.Duration `json:"last_wait"`
+	LastStarted time.Time     `json:"last_started"`
+}
+
+type waiter struct {
+	req    Request
+	seq    uint64
+	queued time.Time
+	ready  chan struct{}
+	err    error
+}
+
+// Pool limits how many runs execute at once, overall and per destination.
+// Runs that can't start wait in a priority queue; a run whose destinations
+// are busy doesn't block runs behind it that write elsewhere.
+type Pool struct {
+	max            int
+	perDestination int
+
+	mu      sync.Mutex
+	seq     uint64
+	waiting []*waiter
+	running int
+	busy    map[string]int
+	stats   Stats
+	closed  bool
+}
+
+// New returns a pool running at most max runs at once and at most
+// perDestination runs per destination. Zero disables a limit.
+func New(max, perDestination int) *Pool {
+	return &Pool{
+		max:            max,
+		perDestination: perDestination,
+		busy:           make(map[string]int),
+	}
+}
+
+// Acquire blocks until req may run or ctx is done. It returns a function
+// that must be called when the run finishes, and how long the run waited.
+func (p *Pool) Acquire(ctx context.Context, req Request) (func(), time.Duration, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, 0, ErrClosed
+	}
+	p.seq++
+	w := &waiter{req: req, seq: p.seq, queued: time.Now(), ready: make(chan struct{})}
+	p.waiting = append(p.waiting, w)
+	p.dispatch()
+	p.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		if w.err != nil {
+			return nil, time.Since(w.queued), w.err
+		}
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		select {
+		case <-w.ready:
+			// Granted while giving up; hand the slot back.
+			if w.err == nil {
+				p.release(w.req)
+			}
+		default:
+			p.remove(w)
+		}
+		return nil, time.Since(w.queued), ctx.Err()
+	}
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.release(w.req)
+		})
+	}
+
+	return release, time.Since(w.queued), nil
+}
+
+// Close rejects all waiting and future runs. Runs that already started
+// are unaffected and still release their slots.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, w := range p.waiting {
+		w.err = ErrClosed
+		close(w.ready)
+	}
+	p.waiting = nil
+}
+
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Running = p.running
+	stats.Queued = len(p.waiting)
+	return stats
+}
+
+// dispatch starts every waiting run that fits, by priority and queue order.
+// Callers must hold p.mu.
+func (p *Pool) dispatch() {
+	if p.closed {
+		return
+	}
+
+	sort.SliceStable(p.waiting, func(i, j int) bool {
+		if p.waiting[i].req.Priority != p.waiting[j].req.Priority {
+			return p.waiting[i].req.Priority > p.waiting[j].req.Priority
+		}
+		return p.waiting[i].seq < p.waiting[j].seq
+	})
+
+	remaining := p.waiting[:0]
+	for _, w := range p.waiting {
+		if !p.fits(w.req) {
+			remaining = append(remaining, w)
+			continue
+		}
+
+		p.running++
+		for _, dest := range w.req.Destinations {
+			p.busy[dest]++
+		}
+
+		wait := time.Since(w.queued)
+		p.stats.Started++
+		p.stats.TotalWait += wait
+		p.stats.LastWait = wait
+		p.stats.LastStarted = time.Now()
+		if wait > p.stats.MaxWait {
+			p.stats.MaxWait = wait
+		}
+		close(w.ready)
+	}
+	p.waiting = remaining
+}
+
+func (p *Pool) fits(req Request) bool {
+	if p.max > 0 && p.running >= p.max {
+		return false
+	}
+	if p.perDestination > 0 {
+		for _, dest := range req.Destinations {
+			if p.busy[dest] >= p.perDestination {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (p *Pool) release(req Request) {
+	p.running--
+	for _, dest := range req.Destinations {
+		p.busy[dest]--
+		if p.busy[dest] == 0 {
+			delete(p.busy, dest)
+		}
+	}
+	p.dispatch()
+}
+
+func (p *Pool) remove(w *waiter) {
+	for i, other := range p.waiting {
+		if other == w {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			return
+		}
+	}
+}
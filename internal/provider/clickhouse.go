@@ -2,6 +2,8 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/bytekai/docker-auto-backup/internal/logger"
 	"github.com/bytekai/docker-auto-backup/internal/models"
@@ -18,6 +20,18 @@ func NewClickhouseProvider(ctx *ProviderContext) *ClickhouseProvider {
 	return &ClickhouseProvider{ctx: ctx}
 }
 
+func (p *ClickhouseProvider) Preflight(c context.Context) error {
+	return fmt.Errorf("%w: ClickHouse backups are not implemented", ErrUnsupported)
+}
+
+func (p *ClickhouseProvider) Ext() string {
+	return "tar"
+}
+
+func (p *ClickhouseProvider) ObjectName(t time.Time) string {
+	return p.ctx.objectName(t, p.Ext())
+}
+
 func (p *ClickhouseProvider) Backup(c context.Context, storage models.Storage) error {
 	return nil
 }
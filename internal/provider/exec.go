@@ -0,0 +1,269 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/naming"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+type execResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// run executes cmd inside the provider's container and waits for it to exit.
+// It is meant for short commands whose output fits in memory.
+func (ctx *ProviderContext) run(c context.Context, cmd []string, env []string) (*execResult, error) {
+	execResp, err := ctx.Client.ContainerExecCreate(c, ctx.ContainerID, container.ExecOptions{
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	resp, err := ctx.Client.ContainerExecAttach(c, execResp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+	defer resp.Close()
+
+	var stdout, stderr bytes.Buffer
+	if _, err := stdcopy.StdCopy(&stdout, &stderr, resp.Reader); err != nil {
+		return nil, fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	exitCode, err := ctx.waitExit(c, execResp.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &execResult{
+		Stdout:   stdout.String(),
+		Stderr:   strings.TrimSpace(stderr.String()),
+		ExitCode: exitCode,
+	}, nil
+}
+
+// feed executes cmd inside the provider's container with input on its stdin
+// and waits for it to exit. Stdout is discarded as it arrives so a chatty
+// command never blocks on a full pipe; stderr is returned.
+func (ctx *ProviderContext) feed(c context.Context, cmd []string, env []string, input io.Reader) (int, string, error) {
+	execResp, err := ctx.Client.ContainerExecCreate(c, ctx.ContainerID, container.ExecOptions{
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	resp, err := ctx.Client.ContainerExecAttach(c, execResp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to attach to exec: %w", err)
+	}
+	defer resp.Close()
+	stop := context.AfterFunc(c, resp.Close)
+	defer stop()
+
+	var stderr bytes.Buffer
+	drained := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(io.Discard, &stderr, resp.Reader)
+		drained <- err
+	}()
+
+	// The command may exit before reading all input, e.g. on an error;
+	// its exit code then tells more than the failed write.
+	_, copyErr := io.Copy(resp.Conn, input)
+	resp.CloseWrite()
+	if err := <-drained; err != nil && c.Err() == nil {
+		return 0, "", fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	exitCode, err := ctx.waitExit(c, execResp.ID)
+	if err != nil {
+		return 0, "", err
+	}
+	if exitCode == 0 && copyErr != nil {
+		return 0, "", fmt.Errorf("failed to write exec input: %w", copyErr)
+	}
+	return exitCode, strings.TrimSpace(stderr.String()), nil
+}
+
+// waitExit waits for an exec to finish and returns its exit code. The output
+// stream can close slightly before the exec is reported as finished.
+func (ctx *ProviderContext) waitExit(c context.Context, execID string) (int, error) {
+	for {
+		inspect, err := ctx.Client.ContainerExecInspect(c, execID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to inspect exec: %w", err)
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		select {
+		case <-c.Done():
+			return 0, c.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+// execStream is a command running in the container whose stdout is read as
+// a stream. Its PID is recorded in a file inside the container so it can be
+// killed when the context is cancelled; closing the connection alone leaves
+// it running.
+type execStream struct {
+	*io.PipeReader
+
+	ctx     *ProviderContext
+	execID  string
+	pidFile string
+	resp    types.HijackedResponse
+	stderr  bytes.Buffer
+	done    chan struct{}
+	stop    func() bool
+	once    sync.Once
+}
+
+// stream starts cmd and returns its stdout. The command is killed if c is
+// cancelled before it exits. Callers must call Wait or Close.
+func (ctx *ProviderContext) stream(c context.Context, cmd []string, env []string) (*execStream, error) {
+	pidFile := fmt.Sprintf("/tmp/docker-auto-backup-%d.pid", time.Now().UnixNano())
+	wrapped := append([]string{"sh", "-c", `echo $$ > "$0" && exec "$@"`, pidFile}, cmd...)
+
+	execResp, err := ctx.Client.ContainerExecCreate(c, ctx.ContainerID, container.ExecOptions{
+		Cmd:          wrapped,
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	resp, err := ctx.Client.ContainerExecAttach(c, execResp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	s := &execStream{
+		PipeReader: pr,
+		ctx:        ctx,
+		execID:     execResp.ID,
+		pidFile:    pidFile,
+		resp:       resp,
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		_, err := stdcopy.StdCopy(pw, &s.stderr, resp.Reader)
+		pw.CloseWithError(err)
+	}()
+
+	s.stop = context.AfterFunc(c, s.kill)
+	return s, nil
+}
+
+// Wait waits for the command to exit and returns its exit code and stderr.
+func (s *execStream) Wait(c context.Context) (int, string, error) {
+	select {
+	case <-s.done:
+	case <-c.Done():
+		s.Close()
+		return 0, "", c.Err()
+	}
+	s.stop()
+	s.resp.Close()
+
+	exitCode, err := s.ctx.waitExit(c, s.execID)
+	if err != nil {
+		return 0, "", err
+	}
+	s.cleanup()
+	return exitCode, strings.TrimSpace(s.stderr.String()), nil
+}
+
+// Close kills the command unless it already exited.
+func (s *execStream) Close() error {
+	s.stop()
+	select {
+	case <-s.done:
+		s.resp.Close()
+		s.cleanup()
+	default:
+		s.kill()
+	}
+	return nil
+}
+
+// kill terminates the command, escalating to SIGKILL if it doesn't exit
+// within a few seconds, and closes the connection.
+func (s *execStream) kill() {
+	s.once.Do(func() {
+		// The caller's context is usually done already.
+		c, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+
+		script := `pid=$(cat "$0" 2>/dev/null) || exit 0
+rm -f "$0"
+kill -TERM "$pid" 2>/dev/null || exit 0
+for i in 1 2 3 4 5; do kill -0 "$pid" 2>/dev/null || exit 0; sleep 1; done
+kill -KILL "$pid"`
+		if _, err := s.ctx.run(c, []string{"sh", "-c", script, s.pidFile}, nil); err != nil {
+			s.ctx.Session.Warn("Failed to kill process in container %s: %v", s.ctx.ContainerID, err)
+		} else {
+			s.ctx.Session.Info("Killed cancelled process in container %s", s.ctx.ContainerID)
+		}
+		s.resp.Close()
+	})
+}
+
+func (s *execStream) cleanup() {
+	s.once.Do(func() {
+		c, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s.ctx.run(c, []string{"rm", "-f", s.pidFile}, nil)
+	})
+}
+
+// requireCommand checks that cmd can be executed inside the container.
+func (ctx *ProviderContext) requireCommand(c context.Context, cmd ...string) error {
+	res, err := ctx.run(c, cmd, nil)
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("%s is not available in the container (exit code %d): %s", cmd[0], res.ExitCode, res.Stderr)
+	}
+	return nil
+}
+
+// objectName names a backup taken at t using the job's naming template.
+func (ctx *ProviderContext) objectName(t time.Time, ext string) string {
+	if ctx.Namer != nil {
+		name, err := ctx.Namer.Name(t, ext)
+		if err == nil {
+			return name
+		}
+		ctx.Session.Warn("Failed to render object name, using the default: %v", err)
+	}
+	return fmt.Sprintf("backup_%s.%s", t.Format(naming.TimestampFormat), ext)
+}
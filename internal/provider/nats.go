@@ -2,6 +2,8 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/bytekai/docker-auto-backup/internal/logger"
 	"github.com/bytekai/docker-auto-backup/internal/models"
@@ -17,6 +19,18 @@ func NewNatsProvider(ctx *ProviderContext) *NatsProvider {
 	return &NatsProvider{ctx: ctx}
 }
 
+func (p *NatsProvider) Preflight(c context.Context) error {
+	return fmt.Errorf("%w: NATS backups are not implemented", ErrUnsupported)
+}
+
+func (p *NatsProvider) Ext() string {
+	return "tar"
+}
+
+func (p *NatsProvider) ObjectName(t time.Time) string {
+	return p.ctx.objectName(t, p.Ext())
+}
+
 func (p *NatsProvider) Backup(c context.Context, storage models.Storage) error {
 	return nil
 }
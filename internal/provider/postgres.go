@@ -1,87 +1,175 @@
 package provider
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bytekai/docker-auto-backup/internal/logger"
 	"github.com/bytekai/docker-auto-backup/internal/models"
-	"github.com/docker/docker/api/types/container"
+	"github.com/bytekai/docker-auto-backup/internal/retry"
+	"github.com/bytekai/docker-auto-backup/internal/secret"
 	"github.com/docker/docker/client"
 )
 
-type PostgresProviderConfig struct{}
+type PostgresProviderConfig struct {
+	User     string
+	Password secret.String
+}
 
 type PostgresProvider struct {
 	name   string
 	images []string
 	ext    string
 	ctx    *ProviderContext
+	config PostgresProviderConfig
 }
 
-func NewPostgresProvider(ctx *ProviderContext) *PostgresProvider {
-	return &PostgresProvider{
+func NewPostgresProvider(ctx *ProviderContext, config *PostgresProviderConfig) *PostgresProvider {
+	p := &PostgresProvider{
 		name:   "postgres",
 		images: []string{"postgres"},
 		ext:    "sql",
 		ctx:    ctx,
 	}
+	if config != nil {
+		p.config = *config
+	}
+	if p.config.User == "" {
+		p.config.User = "postgres"
+	}
+	return p
 }
 
-func (p *PostgresProvider) Backup(c context.Context, storage models.Storage) error {
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("backup_%s.%s", timestamp, p.ext)
-	outputPath := filepath.Join("/backups", filename)
+func (p *PostgresProvider) env() []string {
+	if p.config.Password == "" {
+		return nil
+	}
+	return []string{"PGPASSWORD=" + p.config.Password.Value()}
+}
 
-	p.ctx.Session.Info("Backing up container %s to %s", p.ctx.ContainerID, outputPath)
+func (p *PostgresProvider) Preflight(c context.Context) error {
+	if err := p.ctx.requireCommand(c, "pg_dumpall", "--version"); err != nil {
+		return err
+	}
 
-	execConfig := container.ExecOptions{
-		Cmd: []string{
-			"pg_dumpall",
-			"-U", "postgres",
-			"--clean",
-		},
-		AttachStdout: true,
-		AttachStderr: true,
+	res, err := p.ctx.run(c, []string{"psql", "-U", p.config.User, "-tAc", "SELECT 1"}, p.env())
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("failed to connect as %s: %s", p.config.User, res.Stderr)
 	}
 
-	execResp, err := p.ctx.Client.ContainerExecCreate(c, p.ctx.ContainerID, execConfig)
+	return nil
+}
+
+func (p *PostgresProvider) Ext() string {
+	return p.ext
+}
+
+func (p *PostgresProvider) ObjectName(t time.Time) string {
+	return p.ctx.objectName(t, p.ext)
+}
+
+func (p *PostgresProvider) WaitReady(c context.Context) error {
+	// The official image runs initdb against a server that only listens on
+	// the unix socket, so only a TCP connection means it is really up.
+	for {
+		res, err := p.ctx.run(c, []string{"pg_isready", "-h", "127.0.0.1", "-U", p.config.User}, p.env())
+		if err == nil && res.ExitCode == 0 {
+			return nil
+		}
+
+		select {
+		case <-c.Done():
+			return fmt.Errorf("postgres did not become ready: %w", c.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Check counts the user tables of every database. A restore that left no
+// tables behind, or a count that can't be read, fails the check.
+func (p *PostgresProvider) Check(c context.Context) (string, error) {
+	res, err := p.ctx.run(c, []string{"psql", "-h", "127.0.0.1", "-U", p.config.User, "-d", "postgres", "-tAc",
+		"SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate"}, p.env())
 	if err != nil {
-		p.ctx.Session.Error("Failed to create exec: %v", err)
-		return fmt.Errorf("failed to create exec: %w", err)
+		return "", err
+	}
+	if res.ExitCode != 0 {
+		return "", fmt.Errorf("failed to list databases: %s", res.Stderr)
+	}
+
+	query := `SELECT count(*) FROM information_schema.tables WHERE table_schema NOT IN ('pg_catalog', 'information_schema')`
+	tables, databases := 0, strings.Fields(res.Stdout)
+	for _, db := range databases {
+		res, err := p.ctx.run(c, []string{"psql", "-h", "127.0.0.1", "-U", p.config.User, "-d", db, "-tAc", query}, p.env())
+		if err != nil {
+			return "", err
+		}
+		if res.ExitCode != 0 {
+			return "", fmt.Errorf("sanity query failed on database %s: %s", db, res.Stderr)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(res.Stdout))
+		if err != nil {
+			return "", fmt.Errorf("unexpected table count on database %s: %q", db, res.Stdout)
+		}
+		tables += n
+	}
+	if tables == 0 {
+		return "", errors.New("restored databases contain no user tables")
 	}
 
-	resp, err := p.ctx.Client.ContainerExecAttach(c, execResp.ID, container.ExecStartOptions{})
+	return fmt.Sprintf("%d user tables in %d databases", tables, len(databases)), nil
+}
+
+func (p *PostgresProvider) Backup(c context.Context, storage models.Storage) error {
+	filename := p.ObjectName(time.Now())
+
+	p.ctx.Session.Info("Backing up container %s to %s", p.ctx.ContainerID, filename)
+
+	dump, err := p.ctx.stream(c, []string{"pg_dumpall", "-U", p.config.User, "--clean", "--if-exists"}, p.env())
 	if err != nil {
-		p.ctx.Session.Error("Failed to attach to exec: %v", err)
-		return fmt.Errorf("failed to attach to exec: %w", err)
+		p.ctx.Session.Error("Failed to start pg_dumpall: %v", err)
+		return err
 	}
-	defer resp.Close()
+	defer dump.Close()
 
-	err = storage.Put(c, filename, resp.Reader)
+	err = storage.Put(c, filename, dump)
 	if err != nil {
 		p.ctx.Session.Error("Failed to store backup: %v", err)
 		return fmt.Errorf("failed to store backup: %w", err)
 	}
 
-	execInspect, err := p.ctx.Client.ContainerExecInspect(c, execResp.ID)
+	exitCode, stderr, err := dump.Wait(c)
 	if err != nil {
-		p.ctx.Session.Error("Failed to inspect exec: %v", err)
-		return fmt.Errorf("failed to inspect exec: %w", err)
+		p.ctx.Session.Error("Failed to wait for pg_dumpall: %v", err)
+		return fmt.Errorf("failed to wait for pg_dumpall: %w", err)
 	}
 
-	if execInspect.ExitCode != 0 {
-		p.ctx.Session.Error("pg_dump failed with exit code %d", execInspect.ExitCode)
-		return fmt.Errorf("pg_dump failed with exit code %d", execInspect.ExitCode)
+	if exitCode != 0 {
+		p.ctx.Session.Error("pg_dump failed with exit code %d: %s", exitCode, stderr)
+		err := fmt.Errorf("pg_dump failed with exit code %d: %s", exitCode, stderr)
+		// A missing tool or rejected credentials won't fix themselves.
+		if exitCode == 126 || exitCode == 127 || strings.Contains(stderr, "authentication failed") || strings.Contains(stderr, "does not exist") {
+			return retry.Permanent(err)
+		}
+		return err
 	}
 
 	return nil
 }
 
+// Restore replays a dump through psql, stopping at the first failed
+// statement. Dumps are taken with --clean --if-exists so they apply to a
+// fresh server, except for dropping the role psql is connected as.
 func (p *PostgresProvider) Restore(ctx context.Context, session *logger.Session, cli *client.Client, backupPath string, containerID string) error {
 	file, err := os.Open(backupPath)
 	if err != nil {
@@ -90,54 +178,57 @@ func (p *PostgresProvider) Restore(ctx context.Context, session *logger.Session,
 	}
 	defer file.Close()
 
-	execConfig := container.ExecOptions{
-		Cmd: []string{
-			"psql",
-			"-U", "postgres",
-			"-f", "-",
-		},
-		AttachStdin:  true,
-		AttachStdout: true,
-		AttachStderr: true,
-	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(p.filterDump(pw, io.MultiReader(strings.NewReader("SET statement_timeout = 0;\n"), file)))
+	}()
+	defer pr.Close()
 
-	execResp, err := cli.ContainerExecCreate(ctx, containerID, execConfig)
+	rctx := &ProviderContext{Session: session, Client: cli, ContainerID: containerID}
+	exitCode, stderr, err := rctx.feed(ctx, []string{"psql", "-v", "ON_ERROR_STOP=1", "-U", p.config.User, "-f", "-"}, p.env(), pr)
 	if err != nil {
-		session.Error("Failed to create exec: %v", err)
-		return fmt.Errorf("failed to create exec: %w", err)
+		session.Error("Failed to run psql: %v", err)
+		return fmt.Errorf("failed to run psql: %w", err)
 	}
-
-	resp, err := cli.ContainerExecAttach(ctx, execResp.ID, container.ExecAttachOptions{})
-	if err != nil {
-		session.Error("Failed to attach to exec: %v", err)
-		return fmt.Errorf("failed to attach to exec: %w", err)
+	if exitCode != 0 {
+		session.Error("psql failed with exit code %d: %s", exitCode, stderr)
+		return fmt.Errorf("psql failed with exit code %d: %s", exitCode, stderr)
 	}
-	defer resp.Close()
 
-	_, err = resp.Conn.Write([]byte("SET statement_timeout = 0;\n"))
-	if err != nil {
-		session.Error("Failed to write timeout setting: %v", err)
-		return fmt.Errorf("failed to write timeout setting: %w", err)
-	}
-
-	_, err = io.Copy(resp.Conn, file)
-	if err != nil {
-		session.Error("Failed to copy backup data: %v", err)
-		return fmt.Errorf("failed to copy backup data: %w", err)
-	}
-
-	resp.CloseWrite()
+	return nil
+}
 
-	execInspect, err := cli.ContainerExecInspect(ctx, execResp.ID)
-	if err != nil {
-		session.Error("Failed to inspect exec: %v", err)
-		return fmt.Errorf("failed to inspect exec: %w", err)
+// filterDump copies a dump to w without the statement dropping the role
+// psql is connected as, which always fails.
+func (p *PostgresProvider) filterDump(w io.Writer, dump io.Reader) error {
+	skip := make(map[string]bool)
+	for _, role := range []string{p.config.User, `"` + strings.ReplaceAll(p.config.User, `"`, `""`) + `"`} {
+		skip["DROP ROLE "+role+";"] = true
+		skip["DROP ROLE IF EXISTS "+role+";"] = true
 	}
 
-	if execInspect.ExitCode != 0 {
-		session.Error("psql failed with exit code %d", execInspect.ExitCode)
-		return fmt.Errorf("psql failed with exit code %d", execInspect.ExitCode)
+	r := bufio.NewReader(dump)
+	copying := false
+	for {
+		line, err := r.ReadString('\n')
+		statement := strings.TrimRight(line, "\r\n")
+		switch {
+		case copying:
+			// Table data may contain anything; it ends with a lone \.
+			copying = statement != `\.`
+		case strings.HasPrefix(statement, "COPY ") && strings.HasSuffix(statement, "FROM stdin;"):
+			copying = true
+		case skip[statement]:
+			line = ""
+		}
+		if _, werr := io.WriteString(w, line); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
-
-	return nil
 }
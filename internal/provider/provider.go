@@ -2,21 +2,45 @@ package provider
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/bytekai/docker-auto-backup/internal/logger"
 	"github.com/bytekai/docker-auto-backup/internal/models"
+	"github.com/bytekai/docker-auto-backup/internal/naming"
 	"github.com/docker/docker/client"
 )
 
+// ErrUnsupported is returned by the preflight of providers whose backups are
+// not implemented yet.
+var ErrUnsupported = errors.New("unsupported provider")
+
 type Provider interface {
+	// Preflight checks that a backup could run, e.g. that the dump tool
+	// exists in the container and the credentials work, without taking one.
+	Preflight(ctx context.Context) error
+	// Ext is the file extension of the provider's backups.
+	Ext() string
+	// ObjectName is the name the backup taken at t is stored under.
+	ObjectName(t time.Time) string
 	Backup(ctx context.Context, storage models.Storage) error
 	Restore(ctx context.Context, session *logger.Session, cli *client.Client, backupPath string, containerID string) error
 }
 
+// Checker is implemented by providers that can tell when a freshly started
+// container accepts connections and sanity check restored data.
+type Checker interface {
+	WaitReady(ctx context.Context) error
+	// Check returns a short summary of the restored data, such as table counts.
+	Check(ctx context.Context) (string, error)
+}
+
 type ProviderContext struct {
 	Session     *logger.Session
 	Client      *client.Client
 	ContainerID string
+	// Namer names the job's backups; nil falls back to a flat default.
+	Namer *naming.Namer
 }
 
 type ProviderConfig struct {
@@ -27,18 +51,36 @@ type ProviderConfig struct {
 	RabbitMQ   *RabbitMQProviderConfig
 }
 
-func NewProvider(ctx *ProviderContext, provider string) Provider {
+// NeedsRunning reports whether provider takes backups by executing commands
+// in the container, so its jobs are only scheduled while the container runs.
+// Other providers, e.g. ones reading volumes, also back up stopped ones.
+func NeedsRunning(provider string) bool {
+	switch provider {
+	case "postgres", "redis", "clickhouse", "nats", "rabbitmq":
+		return true
+	default:
+		return false
+	}
+}
+
+// Supported reports whether backups of provider are implemented. Others are
+// recognized but can't take backups yet.
+func Supported(provider string) bool {
+	return provider == "postgres"
+}
+
+func NewProvider(ctx *ProviderContext, provider string, config *ProviderConfig) Provider {
 	switch provider {
 	case "postgres":
-		return &PostgresProvider{ctx: ctx}
+		return NewPostgresProvider(ctx, config.Postgres)
 	case "redis":
-		return &RedisProvider{ctx: ctx}
+		return NewRedisProvider(ctx)
 	case "clickhouse":
-		return &ClickhouseProvider{ctx: ctx}
+		return NewClickhouseProvider(ctx)
 	case "nats":
-		return &NatsProvider{ctx: ctx}
+		return NewNatsProvider(ctx)
 	case "rabbitmq":
-		return &RabbitMQProvider{ctx: ctx}
+		return NewRabbitMQProvider(ctx)
 	default:
 		return nil
 	}
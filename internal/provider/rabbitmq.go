@@ -2,6 +2,8 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/bytekai/docker-auto-backup/internal/logger"
 	"github.com/bytekai/docker-auto-backup/internal/models"
@@ -18,6 +20,18 @@ func NewRabbitMQProvider(ctx *ProviderContext) *RabbitMQProvider {
 	return &RabbitMQProvider{ctx: ctx}
 }
 
+func (p *RabbitMQProvider) Preflight(c context.Context) error {
+	return fmt.Errorf("%w: RabbitMQ backups are not implemented", ErrUnsupported)
+}
+
+func (p *RabbitMQProvider) Ext() string {
+	return "json"
+}
+
+func (p *RabbitMQProvider) ObjectName(t time.Time) string {
+	return p.ctx.objectName(t, p.Ext())
+}
+
 func (p *RabbitMQProvider) Backup(c context.Context, storage models.Storage) error {
 	return nil
 }
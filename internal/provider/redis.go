@@ -2,6 +2,8 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/bytekai/docker-auto-backup/internal/logger"
 	"github.com/bytekai/docker-auto-backup/internal/models"
@@ -26,6 +28,18 @@ func NewRedisProvider(ctx *ProviderContext) *RedisProvider {
 	}
 }
 
+func (p *RedisProvider) Preflight(c context.Context) error {
+	return fmt.Errorf("%w: Redis backups are not implemented", ErrUnsupported)
+}
+
+func (p *RedisProvider) Ext() string {
+	return p.ext
+}
+
+func (p *RedisProvider) ObjectName(t time.Time) string {
+	return p.ctx.objectName(t, p.Ext())
+}
+
 func (p *RedisProvider) Backup(c context.Context, storage models.Storage) error {
 	return nil
 }
@@ -0,0 +1,139 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Policy describes how often and how patiently a failed run is retried.
+type Policy struct {
+	// Attempts is the total number of attempts; values below 1 mean one.
+	Attempts int
+	// Backoff is the delay before the second attempt. It doubles for each
+	// further attempt up to MaxDelay.
+	Backoff  time.Duration
+	MaxDelay time.Duration
+}
+
+// Delay returns how long to wait after the given failed attempt (1-based).
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+func (p Policy) attempts() int {
+	return max(p.Attempts, 1)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one that retrying won't fix, such as bad
+// credentials or a missing tool.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsRetryable reports whether another attempt might succeed. Errors are
+// retryable unless marked permanent, caused by cancellation, or carrying an
+// HTTP status that signals a client error.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var status interface{ HTTPStatusCode() int }
+	if errors.As(err, &status) {
+		code := status.HTTPStatusCode()
+		return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+	}
+
+	// Network failures, restarting databases and the like.
+	return true
+}
+
+type attemptKey struct{}
+
+type attemptInfo struct {
+	attempt, attempts int
+}
+
+// Attempt returns the current attempt and the total number of attempts of
+// the run ctx belongs to. Outside of Do it reports a single attempt.
+func Attempt(ctx context.Context) (attempt, attempts int) {
+	if info, ok := ctx.Value(attemptKey{}).(attemptInfo); ok {
+		return info.attempt, info.attempts
+	}
+	return 1, 1
+}
+
+// Final reports whether err ends the run ctx belongs to, i.e. no further
+// attempt will be made. Notifications are only sent for final outcomes.
+func Final(ctx context.Context, err error) bool {
+	attempt, attempts := Attempt(ctx)
+	return err == nil || attempt >= attempts || !IsRetryable(err) || ctx.Err() != nil
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't retryable,
+// or the policy's attempts are used up. onRetry, if set, is called before
+// each wait.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error, onRetry func(attempt int, delay time.Duration, err error)) error {
+	return DoUntil(ctx, nil, p, fn, onRetry)
+}
+
+// DoUntil is like Do, but also gives up on further attempts once stop is
+// closed. Unlike cancelling ctx, closing stop leaves a running attempt alone.
+func DoUntil(ctx context.Context, stop <-chan struct{}, p Policy, fn func(ctx context.Context) error, onRetry func(attempt int, delay time.Duration, err error)) error {
+	attempts := p.attempts()
+	for attempt := 1; ; attempt++ {
+		err := fn(context.WithValue(ctx, attemptKey{}, attemptInfo{attempt: attempt, attempts: attempts}))
+		if err == nil || attempt >= attempts || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		select {
+		case <-stop:
+			return fmt.Errorf("%w (retry stopped)", err)
+		default:
+		}
+
+		delay := p.Delay(attempt)
+		if onRetry != nil {
+			onRetry(attempt, delay, err)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (retry cancelled: %v)", err, ctx.Err())
+		case <-stop:
+			timer.Stop()
+			return fmt.Errorf("%w (retry stopped)", err)
+		case <-timer.C:
+		}
+	}
+}
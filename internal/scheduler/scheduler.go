@@ -3,6 +3,7 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"hash/fnv"
 	"strconv"
 	"strings"
 	"sync"
@@ -10,7 +11,9 @@ import (
 
 	"github.com/bytekai/docker-auto-backup/internal/clock"
 	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/notifier"
 	"github.com/bytekai/docker-auto-backup/internal/provider"
+	"github.com/bytekai/docker-auto-backup/internal/retry"
 	"github.com/bytekai/docker-auto-backup/internal/storage"
 )
 
@@ -23,29 +26,90 @@ const (
 	Yearly  Frequency = "yearly"
 )
 
+// OverlapPolicy decides what happens when a run is due while the previous
+// run of the same job is still going.
+type OverlapPolicy string
+
+const (
+	// OverlapSkip drops the new run.
+	OverlapSkip OverlapPolicy = "skip"
+	// OverlapQueue starts the new run once the previous one finishes. At
+	// most one run is kept waiting.
+	OverlapQueue OverlapPolicy = "queue"
+	// OverlapCancelPrevious cancels the previous run and starts the new one
+	// as soon as it has stopped.
+	OverlapCancelPrevious OverlapPolicy = "cancel_previous"
+)
+
+func ParseOverlapPolicy(s string) (OverlapPolicy, error) {
+	switch OverlapPolicy(s) {
+	case OverlapSkip, OverlapQueue, OverlapCancelPrevious:
+		return OverlapPolicy(s), nil
+	default:
+		return "", fmt.Errorf("invalid overlap policy: %s", s)
+	}
+}
+
 type Config struct {
-	Enabled        bool
-	Frequency      Frequency
-	Time           string
-	DayOfWeek      int
-	DayOfMonth     int
-	DayOfYear      int
-	TimeZone       *time.Location
+	Enabled    bool
+	Frequency  Frequency
+	Time       string
+	DayOfWeek  int
+	DayOfMonth int
+	DayOfYear  int
+	TimeZone   *time.Location
+	// Spread delays every run by a fixed offset within this window, derived
+	// from the job name, so jobs sharing a time don't all start at once.
+	Spread time.Duration
+	// Jitter adds a further offset within this window that changes from run
+	// to run but is reproducible for a given job and run.
+	Jitter time.Duration
+	// Overlap defaults to OverlapSkip.
+	Overlap OverlapPolicy
+	// Retry re-runs a failed task; the zero value runs it once.
+	Retry retry.Policy
+	// Timeout cancels a run that takes longer; zero means no limit.
+	Timeout        time.Duration
 	Provider       string
-	Location       string
-	LocationPath   string
-	StorageConfig  *storage.StorageConfig
+	Naming         string
+	Priority       int
+	Destinations   []storage.Destination
+	StoragePolicy  storage.Policy
 	ProviderConfig *provider.ProviderConfig
+	Notifiers      []notifier.Config
+	Verify         *VerifyConfig
+}
+
+// VerifyConfig schedules restore verification of a job's backups. Only the
+// schedule fields of Schedule are used.
+type VerifyConfig struct {
+	Schedule Config
+	Command  string
+	Timeout  time.Duration
 }
 
 type Scheduler interface {
 	Start() error
 	Stop() context.Context
+	// Cancel cancels the running task, if any.
+	Cancel()
+	// Next returns when the task runs next.
+	Next() time.Time
+	Stats() Stats
+}
+
+// Stats counts the runs of a scheduler and how overlaps were resolved.
+type Stats struct {
+	Started   int64 `json:"started"`
+	Skipped   int64 `json:"skipped"`
+	Queued    int64 `json:"queued"`
+	Cancelled int64 `json:"cancelled"`
 }
 
 type scheduler struct {
 	config    Config
-	task      func()
+	task      func(ctx context.Context) error
+	ctx       context.Context
 	clock     clock.Clock
 	running   bool
 	stop      chan struct{}
@@ -54,6 +118,16 @@ type scheduler struct {
 	logger    *logger.Logger
 	session   *logger.Session
 	location  *time.Location
+	job       string
+
+	// taskMu guards the state of the current run.
+	taskMu  sync.Mutex
+	current context.CancelFunc
+	pending bool
+	stopped bool
+	// halt is closed by Stop to end pending retries.
+	halt  chan struct{}
+	stats Stats
 }
 
 type Option func(*scheduler)
@@ -70,6 +144,22 @@ func WithLogger(l *logger.Logger) Option {
 	}
 }
 
+// WithContext sets the context runs are derived from. Cancelling it cancels
+// the running task.
+func WithContext(ctx context.Context) Option {
+	return func(s *scheduler) {
+		s.ctx = ctx
+	}
+}
+
+// WithJob sets the job name that spread and jitter offsets are derived from.
+// It is also logged as the job field.
+func WithJob(name string) Option {
+	return func(s *scheduler) {
+		s.job = name
+	}
+}
+
 func parseTime(timeStr string) (hour, minute int, err error) {
 	parts := strings.Split(timeStr, ":")
 	if len(parts) != 2 {
@@ -97,7 +187,26 @@ func isValidDayOfMonth(year int, month time.Month, day int) bool {
 	return day <= lastDay
 }
 
-func New(config Config, task func(), opts ...Option) (Scheduler, error) {
+// shortestPeriod returns the shortest time between two runs of frequency.
+func shortestPeriod(frequency Frequency) time.Duration {
+	day := 24 * time.Hour
+	switch frequency {
+	case Weekly:
+		return 7 * day
+	case Monthly:
+		return 28 * day
+	case Yearly:
+		return 365 * day
+	default:
+		return day
+	}
+}
+
+// New returns a scheduler running task at the times given by config. A task
+// that fails with a retryable error is retried according to config.Retry;
+// cancelling the run's context or stopping the scheduler ends pending
+// retries.
+func New(config Config, task func(ctx context.Context) error, opts ...Option) (Scheduler, error) {
 	if task == nil {
 		return nil, fmt.Errorf("task cannot be nil")
 	}
@@ -139,11 +248,29 @@ func New(config Config, task func(), opts ...Option) (Scheduler, error) {
 		return nil, fmt.Errorf("invalid frequency: %s", config.Frequency)
 	}
 
+	if config.Spread < 0 || config.Jitter < 0 {
+		return nil, fmt.Errorf("spread and jitter must not be negative")
+	}
+	// An offset reaching into the next period would let runs collide or
+	// swap order.
+	if period := shortestPeriod(config.Frequency); config.Spread+config.Jitter >= period {
+		return nil, fmt.Errorf("spread and jitter together must be shorter than %v for %s backups", period, config.Frequency)
+	}
+
+	if config.Overlap == "" {
+		config.Overlap = OverlapSkip
+	}
+	if _, err := ParseOverlapPolicy(string(config.Overlap)); err != nil {
+		return nil, err
+	}
+
 	s := &scheduler{
 		config:   config,
 		clock:    clock.New(),
 		stop:     make(chan struct{}),
+		halt:     make(chan struct{}),
 		task:     task,
+		ctx:      context.Background(),
 		logger:   logger.New(logger.INFO),
 		location: location,
 	}
@@ -153,10 +280,53 @@ func New(config Config, task func(), opts ...Option) (Scheduler, error) {
 	}
 
 	s.session = s.logger.NewSession("[scheduler] ")
+	if s.job != "" {
+		s.session = s.session.With("job", s.job)
+	}
 	return s, nil
 }
 
+// nextRun returns the first run after now, including the job's spread and
+// jitter offsets.
 func (s *scheduler) nextRun(now time.Time) time.Time {
+	if s.config.Spread == 0 && s.config.Jitter == 0 {
+		return s.baseRun(now)
+	}
+
+	// A run whose base time already passed may still be due thanks to its
+	// offset, so start looking one maximum offset back.
+	from := now.Add(-(s.config.Spread + s.config.Jitter))
+	for {
+		base := s.baseRun(from)
+		if next := base.Add(s.offset(base)); !next.Before(now) {
+			return next
+		}
+		from = base.Add(time.Second)
+	}
+}
+
+// offset is the delay of the run scheduled at base.
+func (s *scheduler) offset(base time.Time) time.Duration {
+	offset := hashOffset(s.job, s.config.Spread)
+	if s.config.Jitter > 0 {
+		offset += hashOffset(s.job+"@"+base.UTC().Format(time.RFC3339), s.config.Jitter)
+	}
+	return offset
+}
+
+// hashOffset maps key to a whole number of seconds within window.
+func hashOffset(key string, window time.Duration) time.Duration {
+	seconds := uint64(window / time.Second)
+	if seconds == 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return time.Duration(h.Sum64()%seconds) * time.Second
+}
+
+// baseRun returns the first scheduled time at or after now, without offsets.
+func (s *scheduler) baseRun(now time.Time) time.Time {
 	hour, minute, _ := parseTime(s.config.Time)
 	now = now.In(s.location)
 	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, s.location)
@@ -205,6 +375,10 @@ func (s *scheduler) nextRun(now time.Time) time.Time {
 	return next
 }
 
+func (s *scheduler) Next() time.Time {
+	return s.nextRun(s.clock.Now())
+}
+
 func (s *scheduler) Start() error {
 	s.runningMu.Lock()
 	defer s.runningMu.Unlock()
@@ -214,6 +388,12 @@ func (s *scheduler) Start() error {
 	}
 
 	s.running = true
+	s.taskMu.Lock()
+	if s.stopped {
+		s.halt = make(chan struct{})
+	}
+	s.stopped = false
+	s.taskMu.Unlock()
 	s.session.Info("Starting scheduler")
 	go s.run()
 	return nil
@@ -229,6 +409,14 @@ func (s *scheduler) Stop() context.Context {
 		s.running = false
 	}
 
+	s.taskMu.Lock()
+	if !s.stopped {
+		close(s.halt)
+	}
+	s.stopped = true
+	s.pending = false
+	s.taskMu.Unlock()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		s.jobWaiter.Wait()
@@ -237,6 +425,22 @@ func (s *scheduler) Stop() context.Context {
 	return ctx
 }
 
+func (s *scheduler) Cancel() {
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	if s.current != nil {
+		s.session.Warn("Cancelling running task")
+		s.current()
+	}
+}
+
+func (s *scheduler) Stats() Stats {
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+	return s.stats
+}
+
 func (s *scheduler) run() {
 	for {
 		now := s.clock.Now()
@@ -248,15 +452,89 @@ func (s *scheduler) run() {
 		timer := time.NewTimer(wait)
 		select {
 		case <-timer.C:
-			s.session.Info("Executing scheduled task")
-			s.jobWaiter.Add(1)
-			go func() {
-				defer s.jobWaiter.Done()
-				s.task()
-			}()
+			s.trigger()
 		case <-s.stop:
 			timer.Stop()
 			return
 		}
 	}
 }
+
+// trigger starts a due run, applying the overlap policy if the previous
+// run is still going.
+func (s *scheduler) trigger() {
+	s.taskMu.Lock()
+	defer s.taskMu.Unlock()
+
+	if s.current == nil {
+		s.session.Info("Executing scheduled task")
+		s.startTask()
+		return
+	}
+
+	switch s.config.Overlap {
+	case OverlapQueue:
+		if s.pending {
+			s.stats.Skipped++
+			s.session.Warn("Previous run still in progress and another is already queued, skipping run")
+			return
+		}
+		s.pending = true
+		s.stats.Queued++
+		s.session.Warn("Previous run still in progress, queueing run")
+	case OverlapCancelPrevious:
+		s.current()
+		s.pending = true
+		s.stats.Cancelled++
+		s.session.Warn("Previous run still in progress, cancelling it")
+	default:
+		s.stats.Skipped++
+		s.session.Warn("Previous run still in progress, skipping run")
+	}
+}
+
+// startTask runs the task in the background. Callers must hold taskMu.
+// Stopping the scheduler ends pending retries right away; only an attempt
+// already running is waited for.
+func (s *scheduler) startTask() {
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.current = cancel
+	s.stats.Started++
+
+	halt := s.halt
+	s.jobWaiter.Add(1)
+	go func() {
+		defer s.jobWaiter.Done()
+		retry.DoUntil(ctx, halt, s.config.Retry, s.task, func(attempt int, delay time.Duration, err error) {
+			s.session.Warn("Attempt %d of %d failed, retrying in %v: %v", attempt, s.config.Retry.Attempts, delay, err)
+		})
+		cancel()
+
+		s.taskMu.Lock()
+		defer s.taskMu.Unlock()
+		s.current = nil
+		if s.pending && !s.stopped {
+			s.pending = false
+			s.session.Info("Executing queued task")
+			s.startTask()
+		}
+	}()
+}
+
+// NextRuns returns the next n run times of config after from.
+func NextRuns(config Config, from time.Time, n int, opts ...Option) ([]time.Time, error) {
+	sch, err := New(config, func(context.Context) error { return nil }, opts...)
+	if err != nil {
+		return nil, err
+	}
+	s := sch.(*scheduler)
+
+	runs := make([]time.Time, 0, n)
+	now := from
+	for i := 0; i < n; i++ {
+		next := s.nextRun(now)
+		runs = append(runs, next)
+		now = next.Add(time.Second)
+	}
+	return runs, nil
+}
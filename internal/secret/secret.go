@@ -0,0 +1,94 @@
+package secret
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// String holds a credential. It behaves like a plain string but never
+// reveals its value when marshaled or formatted.
+type String string
+
+func (s String) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return json.Marshal("")
+	}
+	return json.Marshal(redacted)
+}
+
+func (s String) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// Value returns the underlying credential.
+func (s String) Value() string {
+	return string(s)
+}
+
+// Resolve dereferences a single value. Values of the form file:/path are
+// replaced by the trimmed file content and env:NAME by the environment
+// variable; anything else is returned unchanged.
+func Resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "file:"):
+		return readFile(strings.TrimPrefix(value, "file:"))
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+// ResolveMap resolves every value in values. For each of the given secret
+// keys, a <key>_file (or <key>_FILE) entry is read from disk when <key>
+// itself is not set, following the Docker secrets convention.
+func ResolveMap(values map[string]string, secretKeys ...string) (map[string]string, error) {
+	resolved := make(map[string]string, len(values))
+	for key, value := range values {
+		v, err := Resolve(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", key, err)
+		}
+		resolved[key] = v
+	}
+
+	for _, key := range secretKeys {
+		if resolved[key] != "" {
+			continue
+		}
+		for _, suffix := range []string{"_file", "_FILE"} {
+			path, ok := resolved[key+suffix]
+			if !ok || path == "" {
+				continue
+			}
+			v, err := readFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %w", key+suffix, err)
+			}
+			resolved[key] = v
+			break
+		}
+	}
+
+	return resolved, nil
+}
+
+func readFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/bytekai/docker-auto-backup/internal/models"
+	"github.com/bytekai/docker-auto-backup/internal/secret"
+)
+
+type AzureStorage struct {
+	client *azblob.Client
+	config AzureStorageConfig
+}
+
+type AzureStorageConfig struct {
+	AccountName      string
+	AccountKey       secret.String
+	SASToken         secret.String
+	ConnectionString secret.String
+	Endpoint         string
+	Container        string
+	AccessTier       string
+	BlockSize        int64
+}
+
+func NewAzureStorage(c AzureStorageConfig) (*AzureStorage, error) {
+	if c.Container == "" {
+		return nil, fmt.Errorf("azure container cannot be empty")
+	}
+
+	if c.AccessTier != "" && !slices.Contains(blob.PossibleAccessTierValues(), blob.AccessTier(c.AccessTier)) {
+		return nil, fmt.Errorf("invalid azure access tier: %s", c.AccessTier)
+	}
+
+	serviceURL := c.Endpoint
+	if serviceURL == "" && c.AccountName != "" {
+		serviceURL = fmt.Sprintf("https://%s.blob.core.windows.net/", c.AccountName)
+	}
+
+	var (
+		client *azblob.Client
+		err    error
+	)
+	switch {
+	case c.ConnectionString != "":
+		client, err = azblob.NewClientFromConnectionString(c.ConnectionString.Value(), nil)
+	case c.AccountKey != "":
+		var cred *azblob.SharedKeyCredential
+		cred, err = azblob.NewSharedKeyCredential(c.AccountName, c.AccountKey.Value())
+		if err != nil {
+			return nil, fmt.Errorf("failed to create azure shared key credential: %w", err)
+		}
+		client, err = azblob.NewClientWithSharedKeyCredential(serviceURL, cred, nil)
+	case c.SASToken != "":
+		client, err = azblob.NewClientWithNoCredential(serviceURL+"?"+strings.TrimPrefix(c.SASToken.Value(), "?"), nil)
+	default:
+		return nil, fmt.Errorf("azure storage requires a connection string, account key or SAS token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create azure client: %w", err)
+	}
+
+	return &AzureStorage{
+		client: client,
+		config: c,
+	}, nil
+}
+
+func (s *AzureStorage) Put(ctx context.Context, name string, file io.Reader) error {
+	opts := &azblob.UploadStreamOptions{
+		BlockSize: s.config.BlockSize,
+	}
+	if s.config.AccessTier != "" {
+		opts.AccessTier = to.Ptr(blob.AccessTier(s.config.AccessTier))
+	}
+
+	// UploadStream stages fixed-size blocks, so readers of unknown length
+	// such as exec output can be streamed without buffering the whole dump.
+	if _, err := s.client.UploadStream(ctx, s.config.Container, name, file, opts); err != nil {
+		return fmt.Errorf("failed to upload file to azure: %w", err)
+	}
+
+	return nil
+}
+
+func (s *AzureStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.client.DownloadStream(ctx, s.config.Container, name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from azure: %w", err)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *AzureStorage) List(ctx context.Context, prefix string) ([]models.Object, error) {
+	var objects []models.Object
+
+	pager := s.client.NewListBlobsFlatPager(s.config.Container, &azblob.ListBlobsFlatOptions{
+		Prefix: to.Ptr(prefix),
+	})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files in azure: %w", err)
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			if item.Name == nil {
+				continue
+			}
+
+			obj := models.Object{Name: *item.Name}
+			if item.Properties != nil {
+				if item.Properties.ContentLength != nil {
+					obj.Size = *item.Properties.ContentLength
+				}
+				if item.Properties.LastModified != nil {
+					obj.ModTime = *item.Properties.LastModified
+				}
+			}
+			objects = append(objects, obj)
+		}
+	}
+
+	return objects, nil
+}
+
+func (s *AzureStorage) Delete(ctx context.Context, name string) error {
+	if _, err := s.client.DeleteBlob(ctx, s.config.Container, name, nil); err != nil {
+		return fmt.Errorf("failed to delete file from azure: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"google.golang.org/api/googleapi"
+)
+
+// StatusError carries the HTTP status of a failed storage request so
+// callers can tell transient failures from permanent ones. The S3 client's
+// errors already expose their status the same way.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string       { return e.Err.Error() }
+func (e *StatusError) Unwrap() error       { return e.Err }
+func (e *StatusError) HTTPStatusCode() int { return e.Code }
+
+// withStatus attaches the HTTP status of Azure and GCS errors to err.
+func withStatus(err error) error {
+	var azErr *azcore.ResponseError
+	if errors.As(err, &azErr) {
+		return &StatusError{Code: azErr.StatusCode, Err: err}
+	}
+	var gErr *googleapi.Error
+	if errors.As(err, &gErr) {
+		return &StatusError{Code: gErr.Code, Err: err}
+	}
+	return err
+}
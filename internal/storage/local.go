@@ -2,10 +2,15 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/bytekai/docker-auto-backup/internal/models"
 )
 
 type LocalStorage struct {
@@ -34,19 +39,48 @@ func (s *LocalStorage) Put(ctx context.Context, name string, file io.Reader) err
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	out, err := os.Create(fullPath)
+	// Write next to the target and rename, so readers never see a
+	// truncated or half-written file.
+	out, err := os.CreateTemp(filepath.Dir(fullPath), "."+filepath.Base(fullPath)+tempMarker+"*")
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
+	defer os.Remove(out.Name())
 	defer out.Close()
 
-	if _, err := io.Copy(out, file); err != nil {
+	if _, err := io.Copy(out, &contextReader{ctx: ctx, r: file}); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(out.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(out.Name(), fullPath); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
 	return nil
 }
 
+// tempMarker is part of the name of files still being written by Put.
+const tempMarker = ".tmp-"
+
+// contextReader stops reading once ctx is done, so copies into storages
+// that don't take a context can be cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
 func (s *LocalStorage) Get(ctx context.Context, url string) (io.ReadCloser, error) {
 	select {
 	case <-ctx.Done():
@@ -62,3 +96,68 @@ func (s *LocalStorage) Get(ctx context.Context, url string) (io.ReadCloser, erro
 
 	return file, nil
 }
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]models.Object, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	var objects []models.Object
+	err := filepath.WalkDir(s.config.RootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || isTemp(d.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.config.RootPath, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, models.Object{
+			Name:    name,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	return objects, nil
+}
+
+func isTemp(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempMarker)
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, name string) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+
+	fullPath := filepath.Join(s.config.RootPath, name)
+	if err := os.Remove(fullPath); err != nil {
+		return fmt.Errorf("failed to delete file: %w", err)
+	}
+
+	return nil
+}
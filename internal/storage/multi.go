@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/models"
+)
+
+type Policy string
+
+const (
+	// PolicyAll treats a backup as successful only if every destination stored it.
+	PolicyAll Policy = "all"
+	// PolicyAny treats a backup as successful if at least one destination stored it.
+	PolicyAny Policy = "any"
+)
+
+func ParsePolicy(s string) (Policy, error) {
+	switch Policy(s) {
+	case PolicyAll, PolicyAny:
+		return Policy(s), nil
+	default:
+		return "", fmt.Errorf("invalid storage policy: %s", s)
+	}
+}
+
+type Destination struct {
+	Name   string
+	Type   string
+	Config *StorageConfig
+}
+
+type Result struct {
+	Destination string
+	Bytes       int64
+	Duration    time.Duration
+	Err         error
+}
+
+type target struct {
+	name    string
+	storage models.Storage
+}
+
+// MultiStorage replicates every Put to all destinations concurrently while
+// reading the source only once.
+type MultiStorage struct {
+	targets []target
+	policy  Policy
+
+	mu      sync.Mutex
+	results []Result
+}
+
+func NewMultiStorage(policy Policy, destinations map[string]models.Storage) *MultiStorage {
+	names := make([]string, 0, len(destinations))
+	for name := range destinations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	s := &MultiStorage{policy: policy}
+	for _, name := range names {
+		s.targets = append(s.targets, target{name: name, storage: destinations[name]})
+	}
+	return s
+}
+
+// Results returns the per-destination outcome of the most recent Put.
+func (s *MultiStorage) Results() []Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Result(nil), s.results...)
+}
+
+func (s *MultiStorage) Put(ctx context.Context, name string, file io.Reader) error {
+	results := make([]Result, len(s.targets))
+	writers := make([]*io.PipeWriter, len(s.targets))
+
+	var wg sync.WaitGroup
+	for i, t := range s.targets {
+		pr, pw := io.Pipe()
+		writers[i] = pw
+		results[i].Destination = t.name
+
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			start := time.Now()
+			counter := &countingReader{r: pr}
+			err := t.storage.Put(ctx, name, counter)
+			// Unblock the tee if the destination gave up before reading everything.
+			pr.CloseWithError(fmt.Errorf("destination %s closed", t.name))
+			results[i].Bytes = counter.n
+			results[i].Duration = time.Since(start)
+			results[i].Err = withStatus(err)
+		}(i, t)
+	}
+
+	_, copyErr := io.Copy(&teeWriter{writers: writers}, file)
+	for _, pw := range writers {
+		pw.CloseWithError(copyErr)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	s.results = results
+	s.mu.Unlock()
+
+	if copyErr != nil && !errors.Is(copyErr, errAllDestinationsFailed) {
+		return fmt.Errorf("failed to read backup data: %w", copyErr)
+	}
+
+	var failed []string
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r.Destination)
+			errs = append(errs, fmt.Errorf("%s: %w", r.Destination, r.Err))
+		}
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	if s.policy == PolicyAny && len(failed) < len(results) {
+		return nil
+	}
+
+	return fmt.Errorf("failed to store backup in %s: %w", strings.Join(failed, ", "), errors.Join(errs...))
+}
+
+func (s *MultiStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	var errs []error
+	for _, t := range s.targets {
+		r, err := t.storage.Get(ctx, name)
+		if err == nil {
+			return r, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+func (s *MultiStorage) List(ctx context.Context, prefix string) ([]models.Object, error) {
+	seen := make(map[string]bool)
+	var objects []models.Object
+	var errs []error
+	for _, t := range s.targets {
+		list, err := t.storage.List(ctx, prefix)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+			continue
+		}
+		for _, obj := range list {
+			if !seen[obj.Name] {
+				seen[obj.Name] = true
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	if len(errs) == len(s.targets) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return objects, nil
+}
+
+func (s *MultiStorage) Delete(ctx context.Context, name string) error {
+	var errs []error
+	for _, t := range s.targets {
+		if err := t.storage.Delete(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteFailed deletes name from the destinations the most recent Put
+// failed for, leaving complete copies elsewhere alone. It reports whether
+// any destination had failed.
+func (s *MultiStorage) DeleteFailed(ctx context.Context, name string) (bool, error) {
+	failed := make(map[string]bool)
+	for _, r := range s.Results() {
+		if r.Err != nil {
+			failed[r.Destination] = true
+		}
+	}
+
+	var errs []error
+	for _, t := range s.targets {
+		if !failed[t.name] {
+			continue
+		}
+		if err := t.storage.Delete(ctx, name); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t.name, err))
+		}
+	}
+	return len(failed) > 0, errors.Join(errs...)
+}
+
+// Succeeded returns the destinations the most recent Put succeeded for, so
+// files describing that object are only written next to complete copies.
+func (s *MultiStorage) Succeeded() *MultiStorage {
+	ok := make(map[string]bool)
+	for _, r := range s.Results() {
+		if r.Err == nil {
+			ok[r.Destination] = true
+		}
+	}
+
+	succeeded := &MultiStorage{policy: s.policy}
+	for _, t := range s.targets {
+		if ok[t.name] {
+			succeeded.targets = append(succeeded.targets, t)
+		}
+	}
+	return succeeded
+}
+
+var errAllDestinationsFailed = errors.New("all destinations failed")
+
+// teeWriter writes to every pipe that is still accepting data. A destination
+// failing does not stop the others from receiving the stream.
+type teeWriter struct {
+	writers []*io.PipeWriter
+	failed  []bool
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if t.failed == nil {
+		t.failed = make([]bool, len(t.writers))
+	}
+
+	active := 0
+	for i, w := range t.writers {
+		if t.failed[i] {
+			continue
+		}
+		if _, err := w.Write(p); err != nil {
+			t.failed[i] = true
+			continue
+		}
+		active++
+	}
+
+	if active == 0 {
+		return 0, errAllDestinationsFailed
+	}
+	return len(p), nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/bytekai/docker-auto-backup/internal/models"
+	"github.com/bytekai/docker-auto-backup/internal/secret"
 )
 
 type S3Storage struct {
@@ -18,7 +20,7 @@ type S3Storage struct {
 
 type S3StorageConfig struct {
 	AccessKey string
-	SecretKey string
+	SecretKey secret.String
 	Region    string
 	Bucket    string
 }
@@ -26,7 +28,7 @@ type S3StorageConfig struct {
 func NewS3Storage(c S3StorageConfig) (*S3Storage, error) {
 	creds := credentials.NewStaticCredentialsProvider(
 		c.AccessKey,
-		c.SecretKey,
+		c.SecretKey.Value(),
 		"",
 	)
 
@@ -72,3 +74,41 @@ func (s *S3Storage) Get(ctx context.Context, name string) (io.ReadCloser, error)
 
 	return output.Body, nil
 }
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]models.Object, error) {
+	var objects []models.Object
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.config.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list files in S3: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			objects = append(objects, models.Object{
+				Name:    aws.ToString(obj.Key),
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+
+	return objects, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, name string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(name),
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to delete file from S3: %w", err)
+	}
+
+	return nil
+}
@@ -1,17 +1,25 @@
 package storage
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
 	"github.com/bytekai/docker-auto-backup/internal/models"
 	"github.com/bytekai/docker-auto-backup/internal/provider"
 )
 
 type StorageConfig struct {
-	Local *LocalStorageConfig
-	S3    *S3StorageConfig
+	Local  *LocalStorageConfig
+	S3     *S3StorageConfig
+	GCS    *GCSStorageConfig
+	Azure  *AzureStorageConfig
+	WebDAV *WebDAVStorageConfig
 }
 
-func NewStorage(ctx *provider.ProviderContext, provider string, config *StorageConfig) models.Storage {
-	switch provider {
+func NewStorage(ctx *provider.ProviderContext, storageType string, config *StorageConfig) models.Storage {
+	switch storageType {
 	case "local":
 		if config.Local == nil {
 			ctx.Session.Error("Local storage configuration is missing")
@@ -24,9 +32,151 @@ func NewStorage(ctx *provider.ProviderContext, provider string, config *StorageC
 			return nil
 		}
 
-		return &S3Storage{config: *config.S3}
+		s, err := NewS3Storage(*config.S3)
+		if err != nil {
+			ctx.Session.Error("Failed to create S3 storage: %v", err)
+			return nil
+		}
+		return s
+	case "gcs":
+		if config.GCS == nil {
+			ctx.Session.Error("GCS storage configuration is missing")
+			return nil
+		}
+
+		s, err := NewGCSStorage(*config.GCS)
+		if err != nil {
+			ctx.Session.Error("Failed to create GCS storage: %v", err)
+			return nil
+		}
+		return s
+	case "azure":
+		if config.Azure == nil {
+			ctx.Session.Error("Azure storage configuration is missing")
+			return nil
+		}
+
+		s, err := NewAzureStorage(*config.Azure)
+		if err != nil {
+			ctx.Session.Error("Failed to create Azure storage: %v", err)
+			return nil
+		}
+		return s
+	case "webdav":
+		if config.WebDAV == nil {
+			ctx.Session.Error("WebDAV storage configuration is missing")
+			return nil
+		}
+
+		s, err := NewWebDAVStorage(*config.WebDAV)
+		if err != nil {
+			ctx.Session.Error("Failed to create WebDAV storage: %v", err)
+			return nil
+		}
+		return s
 	default:
-		ctx.Session.Error("Unsupported provider: %s", provider)
+		ctx.Session.Error("Unsupported storage: %s", storageType)
 		return nil
 	}
 }
+
+// NewDestinations builds a storage that fans every backup out to all
+// destinations. Destinations that cannot be created are reported as failed
+// for each run so the policy still applies to them.
+func NewDestinations(ctx *provider.ProviderContext, destinations []Destination, policy Policy) *MultiStorage {
+	targets := make(map[string]models.Storage, len(destinations))
+	for _, dest := range destinations {
+		s := NewStorage(ctx, dest.Type, dest.Config)
+		if s == nil {
+			s = &unavailableStorage{err: fmt.Errorf("storage %s (%s) is unavailable", dest.Name, dest.Type)}
+		}
+		targets[dest.Name] = s
+	}
+
+	return NewMultiStorage(policy, targets)
+}
+
+type unavailableStorage struct {
+	err error
+}
+
+func (s *unavailableStorage) Put(ctx context.Context, name string, file io.Reader) error {
+	return s.err
+}
+
+func (s *unavailableStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	return nil, s.err
+}
+
+func (s *unavailableStorage) List(ctx context.Context, prefix string) ([]models.Object, error) {
+	return nil, s.err
+}
+
+func (s *unavailableStorage) Delete(ctx context.Context, name string) error {
+	return s.err
+}
+
+// Validate reports settings required by storageType that are missing from
+// the config, without connecting to the storage.
+func (c *StorageConfig) Validate(storageType string) error {
+	var missing []string
+	switch storageType {
+	case "local":
+		if c.Local == nil {
+			return fmt.Errorf("local storage configuration is missing")
+		}
+		if c.Local.RootPath == "" {
+			missing = append(missing, "root_path")
+		}
+	case "s3":
+		if c.S3 == nil {
+			return fmt.Errorf("S3 storage configuration is missing")
+		}
+		if c.S3.Bucket == "" {
+			missing = append(missing, "bucket")
+		}
+		if c.S3.Region == "" {
+			missing = append(missing, "region")
+		}
+		if c.S3.AccessKey == "" {
+			missing = append(missing, "access_key")
+		}
+		if c.S3.SecretKey == "" {
+			missing = append(missing, "secret_key")
+		}
+	case "gcs":
+		if c.GCS == nil {
+			return fmt.Errorf("GCS storage configuration is missing")
+		}
+		if c.GCS.Bucket == "" {
+			missing = append(missing, "bucket")
+		}
+	case "azure":
+		if c.Azure == nil {
+			return fmt.Errorf("azure storage configuration is missing")
+		}
+		if c.Azure.Container == "" {
+			missing = append(missing, "container")
+		}
+		if c.Azure.ConnectionString == "" && c.Azure.AccountName == "" {
+			missing = append(missing, "account_name")
+		}
+		if c.Azure.ConnectionString == "" && c.Azure.AccountKey == "" && c.Azure.SASToken == "" {
+			missing = append(missing, "account_key, sas_token or connection_string")
+		}
+	case "webdav":
+		if c.WebDAV == nil {
+			return fmt.Errorf("WebDAV storage configuration is missing")
+		}
+		if c.WebDAV.URL == "" {
+			missing = append(missing, "url")
+		}
+	default:
+		return fmt.Errorf("unsupported storage: %s", storageType)
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,590 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/models"
+	"github.com/bytekai/docker-auto-backup/internal/secret"
+)
+
+type WebDAVStorage struct {
+	client  *http.Client
+	config  WebDAVStorageConfig
+	baseURL *url.URL
+
+	digestMu  sync.Mutex
+	challenge map[string]string
+	nonceUses int
+}
+
+type WebDAVStorageConfig struct {
+	URL      string
+	Username string
+	Password secret.String
+	// Auth is "basic" or "digest". When empty the scheme is negotiated from
+	// the server's WWW-Authenticate challenge.
+	Auth string
+	// ChunkSize enables Nextcloud style chunked uploads through UploadsURL
+	// (e.g. https://cloud/remote.php/dav/uploads/<user>) for large files.
+	ChunkSize  int64
+	UploadsURL string
+}
+
+func NewWebDAVStorage(c WebDAVStorageConfig) (*WebDAVStorage, error) {
+	if c.URL == "" {
+		return nil, fmt.Errorf("WebDAV URL cannot be empty")
+	}
+
+	baseURL, err := url.Parse(strings.TrimSuffix(c.URL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebDAV URL: %w", err)
+	}
+
+	switch c.Auth {
+	case "", "basic", "digest":
+	default:
+		return nil, fmt.Errorf("invalid WebDAV auth: %s", c.Auth)
+	}
+
+	if c.ChunkSize > 0 && c.UploadsURL == "" {
+		return nil, fmt.Errorf("WebDAV chunked uploads require an uploads URL")
+	}
+
+	return &WebDAVStorage{
+		client:  &http.Client{},
+		config:  c,
+		baseURL: baseURL,
+	}, nil
+}
+
+func (s *WebDAVStorage) Put(ctx context.Context, name string, file io.Reader) error {
+	if err := s.mkcolAll(ctx, path.Dir(name)); err != nil {
+		return fmt.Errorf("failed to create WebDAV collection: %w", err)
+	}
+
+	if s.config.ChunkSize > 0 {
+		if err := s.putChunked(ctx, name, file); err != nil {
+			return fmt.Errorf("failed to upload file to WebDAV: %w", err)
+		}
+		return nil
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, s.resolve(name), file, nil)
+	if err != nil {
+		return fmt.Errorf("failed to upload file to WebDAV: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *WebDAVStorage) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := s.do(ctx, http.MethodGet, s.resolve(name), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file from WebDAV: %w", err)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *WebDAVStorage) List(ctx context.Context, prefix string) ([]models.Object, error) {
+	// Depth: infinity is disabled on most servers, so walk collections one
+	// level at a time starting from the deepest collection in the prefix.
+	root := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = prefix[:i+1]
+	}
+
+	var objects []models.Object
+	pending := []string{root}
+	for len(pending) > 0 {
+		dir := pending[0]
+		pending = pending[1:]
+
+		entries, err := s.propfind(ctx, dir)
+		if err != nil {
+			if errors.Is(err, errWebDAVNotFound) && dir == root {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to list files in WebDAV: %w", err)
+		}
+
+		for _, entry := range entries {
+			if entry.dir {
+				if strings.HasPrefix(entry.name, prefix) || strings.HasPrefix(prefix, entry.name) {
+					pending = append(pending, entry.name)
+				}
+				continue
+			}
+			if strings.HasPrefix(entry.name, prefix) {
+				objects = append(objects, entry.Object)
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+func (s *WebDAVStorage) Delete(ctx context.Context, name string) error {
+	resp, err := s.do(ctx, http.MethodDelete, s.resolve(name), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete file from WebDAV: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (s *WebDAVStorage) resolve(name string) string {
+	u := *s.baseURL
+	u.Path = path.Join(s.baseURL.Path, name)
+	if strings.HasSuffix(name, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+func (s *WebDAVStorage) mkcolAll(ctx context.Context, dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+
+	current := ""
+	for _, part := range strings.Split(dir, "/") {
+		if part == "" {
+			continue
+		}
+		current += part + "/"
+
+		resp, err := s.do(ctx, "MKCOL", s.resolve(current), nil, nil)
+		if err != nil {
+			// 405 Method Not Allowed means the collection already exists.
+			var statusErr *webdavStatusError
+			if errors.As(err, &statusErr) && statusErr.code == http.StatusMethodNotAllowed {
+				continue
+			}
+			return err
+		}
+		resp.Body.Close()
+	}
+
+	return nil
+}
+
+func (s *WebDAVStorage) putChunked(ctx context.Context, name string, file io.Reader) error {
+	uploadID := "docker-auto-backup-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	uploadURL := strings.TrimSuffix(s.config.UploadsURL, "/") + "/" + uploadID
+
+	headers := map[string]string{"Destination": s.resolve(name)}
+
+	resp, err := s.do(ctx, "MKCOL", uploadURL, nil, headers)
+	if err != nil {
+		return fmt.Errorf("failed to create upload session: %w", err)
+	}
+	resp.Body.Close()
+
+	abort := func() {
+		if resp, err := s.do(context.Background(), http.MethodDelete, uploadURL, nil, nil); err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	buf := make([]byte, s.config.ChunkSize)
+	for chunk := 1; ; chunk++ {
+		n, readErr := io.ReadFull(file, buf)
+		if n > 0 {
+			chunkURL := fmt.Sprintf("%s/%05d", uploadURL, chunk)
+			resp, err := s.do(ctx, http.MethodPut, chunkURL, bytes.NewReader(buf[:n]), headers)
+			if err != nil {
+				abort()
+				return fmt.Errorf("failed to upload chunk %d: %w", chunk, err)
+			}
+			resp.Body.Close()
+		}
+
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			abort()
+			return readErr
+		}
+	}
+
+	resp, err = s.do(ctx, "MOVE", uploadURL+"/.file", nil, headers)
+	if err != nil {
+		abort()
+		return fmt.Errorf("failed to assemble chunks: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+var errWebDAVNotFound = errors.New("not found")
+
+type webdavStatusError struct {
+	method string
+	code   int
+}
+
+func (e *webdavStatusError) Error() string {
+	return fmt.Sprintf("%s returned status %d", e.method, e.code)
+}
+
+func (e *webdavStatusError) HTTPStatusCode() int {
+	return e.code
+}
+
+func (e *webdavStatusError) Unwrap() error {
+	if e.code == http.StatusNotFound {
+		return errWebDAVNotFound
+	}
+	return nil
+}
+
+func (s *WebDAVStorage) do(ctx context.Context, method, target string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	if s.config.Auth == "digest" || (s.config.Auth == "" && s.config.Username != "") {
+		if err := s.ensureChallenge(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	// A streamed body can't be sent again after a stale nonce, so make sure
+	// the nonce is still accepted before sending it.
+	replayable := body == nil || req.GetBody != nil
+	if !replayable && s.usesDigest() {
+		if err := s.probe(ctx, target); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.authorize(req); err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized && s.refreshChallenge(resp) && replayable {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		retry := req.Clone(ctx)
+		if req.GetBody != nil {
+			if retry.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.authorize(retry); err != nil {
+			return nil, err
+		}
+		if resp, err = s.client.Do(retry); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.StatusCode >= 300 {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, &webdavStatusError{method: method, code: resp.StatusCode}
+	}
+
+	return resp, nil
+}
+
+// probe sends a bodiless request to target so a stale nonce is renewed
+// before a request that can't be repeated.
+func (s *WebDAVStorage) probe(ctx context.Context, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, target, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.authorize(req); err != nil {
+		return err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized && !s.refreshChallenge(resp) {
+		return &webdavStatusError{method: http.MethodHead, code: resp.StatusCode}
+	}
+	return nil
+}
+
+// usesDigest reports whether requests are authorized with digest auth.
+func (s *WebDAVStorage) usesDigest() bool {
+	s.digestMu.Lock()
+	defer s.digestMu.Unlock()
+	return s.config.Username != "" && s.config.Auth != "basic" && s.challenge["scheme"] == "digest"
+}
+
+// refreshChallenge handles a 401 response. It reports whether the server
+// renewed a stale nonce, in which case the request can be sent once more
+// with the new challenge. Otherwise a fresh challenge is fetched next time.
+func (s *WebDAVStorage) refreshChallenge(resp *http.Response) bool {
+	s.digestMu.Lock()
+	defer s.digestMu.Unlock()
+
+	challenge, ok := digestChallenge(resp.Header)
+	if !ok || !strings.EqualFold(challenge["stale"], "true") {
+		s.challenge = nil
+		return false
+	}
+	s.challenge = challenge
+	s.nonceUses = 0
+	return true
+}
+
+// ensureChallenge fetches the server's WWW-Authenticate challenge once so
+// that streamed request bodies never have to be replayed after a 401.
+func (s *WebDAVStorage) ensureChallenge(ctx context.Context) error {
+	s.digestMu.Lock()
+	defer s.digestMu.Unlock()
+
+	if s.challenge != nil {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, s.baseURL.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	s.challenge = map[string]string{}
+	if challenge, ok := digestChallenge(resp.Header); ok {
+		s.challenge = challenge
+	}
+	s.nonceUses = 0
+
+	return nil
+}
+
+// digestChallenge returns the parameters of a Digest challenge in header,
+// with "scheme" set to "digest".
+func digestChallenge(header http.Header) (map[string]string, bool) {
+	for _, value := range header.Values("WWW-Authenticate") {
+		scheme, params, ok := strings.Cut(value, " ")
+		if ok && strings.EqualFold(scheme, "Digest") {
+			challenge := parseDigestChallenge(params)
+			challenge["scheme"] = "digest"
+			return challenge, true
+		}
+	}
+	return nil, false
+}
+
+func (s *WebDAVStorage) authorize(req *http.Request) error {
+	if s.config.Username == "" {
+		return nil
+	}
+
+	s.digestMu.Lock()
+	defer s.digestMu.Unlock()
+
+	if s.config.Auth == "basic" || s.challenge["scheme"] != "digest" {
+		req.SetBasicAuth(s.config.Username, s.config.Password.Value())
+		return nil
+	}
+
+	// RFC 7616 algorithms; a missing parameter means MD5. The -sess
+	// variants hash the nonces into the credentials.
+	algorithm := s.challenge["algorithm"]
+	base, sess := strings.CutSuffix(strings.ToUpper(algorithm), "-SESS")
+	if base == "" {
+		base = "MD5"
+	}
+	hash, ok := digestHashes[base]
+	if !ok {
+		return fmt.Errorf("unsupported digest algorithm: %s", algorithm)
+	}
+
+	s.nonceUses++
+	nc := fmt.Sprintf("%08x", s.nonceUses)
+	cnonceBytes := make([]byte, 8)
+	rand.Read(cnonceBytes)
+	cnonce := hex.EncodeToString(cnonceBytes)
+
+	realm, nonce, qop := s.challenge["realm"], s.challenge["nonce"], s.challenge["qop"]
+	uri := req.URL.RequestURI()
+	ha1 := hash(s.config.Username + ":" + realm + ":" + s.config.Password.Value())
+	if sess {
+		ha1 = hash(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := hash(req.Method + ":" + uri)
+
+	var response string
+	if qop != "" {
+		qop = "auth"
+		response = hash(strings.Join([]string{ha1, nonce, nc, cnonce, qop, ha2}, ":"))
+	} else {
+		response = hash(ha1 + ":" + nonce + ":" + ha2)
+	}
+
+	auth := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		s.config.Username, realm, nonce, uri, response)
+	if algorithm != "" {
+		auth += ", algorithm=" + algorithm
+	}
+	if qop != "" {
+		auth += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	if opaque := s.challenge["opaque"]; opaque != "" {
+		auth += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	req.Header.Set("Authorization", auth)
+	return nil
+}
+
+func parseDigestChallenge(params string) map[string]string {
+	challenge := make(map[string]string)
+	for _, part := range strings.Split(params, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		challenge[strings.ToLower(key)] = strings.Trim(value, `"`)
+	}
+	return challenge
+}
+
+var digestHashes = map[string]func(string) string{
+	"MD5":         md5Hex,
+	"SHA-256":     sha256Hex,
+	"SHA-512-256": sha512_256Hex,
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func sha512_256Hex(s string) string {
+	sum := sha512.Sum512_256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+type webdavEntry struct {
+	models.Object
+	name string
+	dir  bool
+}
+
+type propfindResponse struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength string `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+func (s *WebDAVStorage) propfind(ctx context.Context, dir string) ([]webdavEntry, error) {
+	target := s.resolve(dir)
+	if !strings.HasSuffix(target, "/") {
+		target += "/"
+	}
+
+	resp, err := s.do(ctx, "PROPFIND", target, strings.NewReader(propfindBody), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result propfindResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode PROPFIND response: %w", err)
+	}
+
+	var entries []webdavEntry
+	for _, r := range result.Responses {
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			href = r.Href
+		}
+		if u, err := url.Parse(href); err == nil && u.IsAbs() {
+			href = u.Path
+		}
+
+		name := strings.TrimPrefix(href, s.baseURL.Path)
+		if strings.TrimSuffix(name, "/") == strings.TrimSuffix(dir, "/") {
+			continue
+		}
+
+		entry := webdavEntry{}
+		for _, ps := range r.Propstat {
+			if ps.Prop.ResourceType.Collection != nil {
+				entry.dir = true
+			}
+			if ps.Prop.ContentLength != "" {
+				entry.Size, _ = strconv.ParseInt(ps.Prop.ContentLength, 10, 64)
+			}
+			if ps.Prop.LastModified != "" {
+				entry.ModTime, _ = http.ParseTime(ps.Prop.LastModified)
+			}
+		}
+
+		if entry.dir && !strings.HasSuffix(name, "/") {
+			name += "/"
+		}
+		entry.name = name
+		entry.Name = name
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
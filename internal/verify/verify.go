@@ -0,0 +1,297 @@
+package verify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/catalog"
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/models"
+	"github.com/bytekai/docker-auto-backup/internal/provider"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Label marks containers created for verification so the daemon never
+// schedules backups for them.
+const Label = "docker-auto-backup.verify"
+
+// IsVerification reports whether a container with the given labels was
+// created for verification. Such containers inherit the image's labels,
+// which may include backup.* ones, so they must be told apart by Label.
+func IsVerification(labels map[string]string) bool {
+	_, ok := labels[Label]
+	return ok
+}
+
+// ResultSuffix is appended to a backup's object name to store the outcome
+// of verifying it.
+const ResultSuffix = ".verify.json"
+
+type Status string
+
+const (
+	Passed Status = "passed"
+	Failed Status = "failed"
+)
+
+type Result struct {
+	Container string        `json:"container"`
+	Image     string        `json:"image"`
+	Object    string        `json:"object"`
+	Status    Status        `json:"status"`
+	Summary   string        `json:"summary,omitempty"`
+	Output    string        `json:"output,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Time      time.Time     `json:"time"`
+}
+
+type Options struct {
+	Provider       string
+	ProviderConfig *provider.ProviderConfig
+	// Command is run through sh -c in the restored container; a non-zero
+	// exit code fails the verification.
+	Command string
+	// Prefix narrows the search for the latest backup to the job's objects.
+	// It must not be empty.
+	Prefix string
+	// Timeout bounds restoring and checking the backup; storing the result
+	// isn't limited by it. Zero means no limit.
+	Timeout time.Duration
+}
+
+type Verifier struct {
+	cli     *client.Client
+	session *logger.Session
+}
+
+func New(cli *client.Client, session *logger.Session) *Verifier {
+	return &Verifier{cli: cli, session: session}
+}
+
+// Run restores the latest backup of sourceID into a throwaway container
+// created from the same image, checks it and removes the container again.
+// The result is also stored next to the backup in storage.
+func (v *Verifier) Run(ctx context.Context, sourceID string, storage models.Storage, opts Options) (*Result, error) {
+	start := time.Now()
+	result := &Result{Container: sourceID, Time: start}
+
+	runCtx, cancel := ctx, context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	err := v.run(runCtx, sourceID, storage, opts, result)
+	cancel()
+	result.Duration = time.Since(start)
+	result.Status = Passed
+	if err != nil {
+		result.Status = Failed
+		result.Error = err.Error()
+	}
+
+	if result.Object != "" {
+		data, marshalErr := json.MarshalIndent(result, "", "  ")
+		if marshalErr == nil {
+			if putErr := storage.Put(ctx, result.Object+ResultSuffix, bytes.NewReader(data)); putErr != nil {
+				v.session.Warn("Failed to record verification result for %s: %v", result.Object, putErr)
+			}
+		}
+	}
+
+	return result, err
+}
+
+func (v *Verifier) run(ctx context.Context, sourceID string, storage models.Storage, opts Options, result *Result) error {
+	source, err := v.cli.ContainerInspect(ctx, sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect source container: %w", err)
+	}
+	result.Image = source.Config.Image
+
+	sourceProvider := provider.NewProvider(&provider.ProviderContext{Session: v.session}, opts.Provider, opts.ProviderConfig)
+	if sourceProvider == nil {
+		return fmt.Errorf("unsupported provider: %s", opts.Provider)
+	}
+
+	object, err := Latest(ctx, storage, opts.Prefix, sourceProvider.Ext())
+	if err != nil {
+		return err
+	}
+	result.Object = object
+
+	backupPath, err := download(ctx, storage, object)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(backupPath)
+
+	name := fmt.Sprintf("%s-verify-%d", strings.TrimPrefix(source.Name, "/"), time.Now().Unix())
+	created, err := v.cli.ContainerCreate(ctx, &container.Config{
+		Image:  source.Image,
+		Env:    source.Config.Env,
+		Cmd:    source.Config.Cmd,
+		Labels: map[string]string{Label: sourceID},
+	}, &container.HostConfig{}, nil, nil, name)
+	if err != nil {
+		return fmt.Errorf("failed to create verification container: %w", err)
+	}
+	defer func() {
+		// Use a fresh context so the container is removed even after a timeout.
+		err := v.cli.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{
+			Force:         true,
+			RemoveVolumes: true,
+		})
+		if err != nil {
+			v.session.Error("Failed to remove verification container %s: %v", name, err)
+		}
+	}()
+
+	if err := v.cli.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return fmt.Errorf("failed to start verification container: %w", err)
+	}
+	v.session.Info("Started verification container %s for %s", name, object)
+
+	pCtx := &provider.ProviderContext{
+		Session:     v.session,
+		Client:      v.cli,
+		ContainerID: created.ID,
+	}
+	p := provider.NewProvider(pCtx, opts.Provider, opts.ProviderConfig)
+	checker, canCheck := p.(provider.Checker)
+
+	if canCheck {
+		if err := checker.WaitReady(ctx); err != nil {
+			return err
+		}
+	}
+
+	if err := p.Restore(ctx, v.session, v.cli, backupPath, created.ID); err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+
+	if canCheck {
+		summary, err := checker.Check(ctx)
+		if err != nil {
+			return err
+		}
+		result.Summary = summary
+	}
+
+	if opts.Command != "" {
+		output, err := v.exec(ctx, created.ID, opts.Command)
+		result.Output = output
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Latest returns the most recent backup below prefix with the given extension.
+// Without a prefix the backups of other jobs sharing the storage can't be
+// told apart, so an empty prefix is refused.
+func Latest(ctx context.Context, storage models.Storage, prefix, ext string) (string, error) {
+	if prefix == "" {
+		return "", errors.New("cannot tell this job's backups apart from others: the naming template must start with a directory specific to the job, e.g. {{.Job}}/")
+	}
+
+	objects, err := storage.List(ctx, prefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var backups []models.Object
+	for _, obj := range objects {
+		if strings.HasSuffix(obj.Name, "."+ext) && !catalog.IsMetadata(obj.Name) && !strings.HasSuffix(obj.Name, ResultSuffix) {
+			backups = append(backups, obj)
+		}
+	}
+	if len(backups) == 0 {
+		return "", errors.New("no backups found")
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		if backups[i].ModTime.Equal(backups[j].ModTime) {
+			return backups[i].Name < backups[j].Name
+		}
+		return backups[i].ModTime.Before(backups[j].ModTime)
+	})
+	return backups[len(backups)-1].Name, nil
+}
+
+func download(ctx context.Context, storage models.Storage, object string) (string, error) {
+	r, err := storage.Get(ctx, object)
+	if err != nil {
+		return "", fmt.Errorf("failed to download backup: %w", err)
+	}
+	defer r.Close()
+
+	f, err := os.CreateTemp("", "verify-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to download backup: %w", err)
+	}
+
+	return f.Name(), nil
+}
+
+func (v *Verifier) exec(ctx context.Context, containerID, command string) (string, error) {
+	execResp, err := v.cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          []string{"sh", "-c", command},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	resp, err := v.cli.ContainerExecAttach(ctx, execResp.ID, container.ExecStartOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to attach to exec: %w", err)
+	}
+	defer resp.Close()
+
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, resp.Reader); err != nil {
+		return "", fmt.Errorf("failed to read check output: %w", err)
+	}
+
+	// Podman can close the output stream before it reports the exec as
+	// finished, with a zero exit code until then.
+	var inspect container.ExecInspect
+	for {
+		inspect, err = v.cli.ContainerExecInspect(ctx, execResp.ID)
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect exec: %w", err)
+		}
+		if !inspect.Running {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return output.String(), ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if inspect.ExitCode != 0 {
+		return output.String(), fmt.Errorf("check command failed with exit code %d", inspect.ExitCode)
+	}
+
+	return output.String(), nil
+}
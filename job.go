@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/bytekai/docker-auto-backup/internal/scheduler"
+)
+
+const (
+	composeProjectLabel = "com.docker.compose.project"
+	composeServiceLabel = "com.docker.compose.service"
+	// podman-compose sets its own project label.
+	podmanComposeProjectLabel = "io.podman.compose.project"
+)
+
+// job identifies what is backed up independently of the container that
+// currently runs it, so schedules, object names and history carry over when
+// a container is recreated.
+type job struct {
+	Name        string
+	ContainerID string
+	Container   string
+	Project     string
+	Service     string
+
+	// host runs the container.
+	host *host
+}
+
+// newJob derives the job of a container from its raw labels: an explicit
+// backup.name label, else its Swarm service, else its compose project and
+// service, else its name.
+func newJob(containerID, containerName string, labels map[string]string) job {
+	return job{
+		Name:        jobName(containerName, labels),
+		ContainerID: containerID,
+		Container:   strings.TrimPrefix(containerName, "/"),
+		Project:     composeProject(labels),
+		Service:     labels[composeServiceLabel],
+	}
+}
+
+func jobName(containerName string, labels map[string]string) string {
+	if name := strings.Trim(labels["backup.name"], "/ "); name != "" {
+		return name
+	}
+	if name, ok := swarmJobName(labels); ok {
+		return name
+	}
+	project, service := composeProject(labels), labels[composeServiceLabel]
+	if project != "" && service != "" {
+		return project + "-" + service
+	}
+	return strings.TrimPrefix(containerName, "/")
+}
+
+// hash summarizes what the job's schedulers are built from: the container
+// and its backup.* labels. labels are the container's raw labels.
+func (j job) hash(labels map[string]string) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	enc.Encode(j)
+	// Maps are encoded with sorted keys.
+	enc.Encode(extractLabels(labels))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fields are the structured log fields identifying the job.
+func (j job) fields(config *scheduler.Config) []any {
+	fields := []any{"job", j.Name, "container", j.Container, "container_id", j.ContainerID[:min(12, len(j.ContainerID))], "provider", config.Provider}
+	if j.host != nil && j.host.name != "" {
+		fields = append(fields, "host", j.host.name)
+	}
+	return fields
+}
+
+func composeProject(labels map[string]string) string {
+	if project := labels[composeProjectLabel]; project != "" {
+		return project
+	}
+	return labels[podmanComposeProjectLabel]
+}
+
+func (j job) String() string {
+	if len(j.ContainerID) > 12 {
+		return j.Name + " (" + j.ContainerID[:12] + ")"
+	}
+	return j.Name + " (" + j.ContainerID + ")"
+}
+
+func containerName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(names[0], "/")
+}
@@ -2,29 +2,37 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/bytekai/docker-auto-backup/internal/config"
 	"github.com/bytekai/docker-auto-backup/internal/logger"
-	"github.com/bytekai/docker-auto-backup/internal/manager"
+	"github.com/bytekai/docker-auto-backup/internal/naming"
+	"github.com/bytekai/docker-auto-backup/internal/notifier"
 	"github.com/bytekai/docker-auto-backup/internal/provider"
+	"github.com/bytekai/docker-auto-backup/internal/retry"
 	"github.com/bytekai/docker-auto-backup/internal/scheduler"
+	"github.com/bytekai/docker-auto-backup/internal/secret"
 	"github.com/bytekai/docker-auto-backup/internal/storage"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/api/types/events"
-	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/client"
 )
 
 func extractLabels(labels map[string]string) map[string]string {
+	return extractPrefixed(labels, "backup.")
+}
+
+func extractPrefixed(labels map[string]string, prefix string) map[string]string {
 	extracted := make(map[string]string)
 	for key, value := range labels {
-		if strings.HasPrefix(key, "backup.") {
-			extracted[strings.TrimPrefix(key, "backup.")] = value
+		if strings.HasPrefix(key, prefix) {
+			extracted[strings.TrimPrefix(key, prefix)] = value
 		}
 	}
 	return extracted
@@ -58,21 +66,81 @@ func parseIntWithDefault(labels map[string]string, key string, defaultValue int)
 	return defaultValue, nil
 }
 
-func buildStorageConfig(labels map[string]string) (*storage.StorageConfig, error) {
-	storageType := getStringWithDefault(labels, "storage", "local")
+func parseDurationWithDefault(labels map[string]string, key string, defaultValue time.Duration) (time.Duration, error) {
+	if val := labels[key]; val != "" {
+		return time.ParseDuration(val)
+	}
+	return defaultValue, nil
+}
+
+// storageSecrets lists the settings of each storage type that hold
+// credentials and may therefore also be given as <key>_file.
+var storageSecrets = map[string][]string{
+	"s3":     {"access_key", "secret_key"},
+	"gcs":    {"credentials_json"},
+	"azure":  {"account_key", "sas_token", "connection_string"},
+	"webdav": {"username", "password"},
+}
+
+func buildStorageConfig(storageType string, labels map[string]string) (*storage.StorageConfig, error) {
+	labels, err := secret.ResolveMap(labels, storageSecrets[storageType]...)
+	if err != nil {
+		return nil, err
+	}
 
 	storageConfig := &storage.StorageConfig{}
 	switch storageType {
 	case "local":
 		storageConfig.Local = &storage.LocalStorageConfig{
-			RootPath: labels["storage.local.root_path"],
+			RootPath: labels["root_path"],
 		}
 	case "s3":
 		storageConfig.S3 = &storage.S3StorageConfig{
-			Bucket:    labels["storage.s3.bucket"],
-			Region:    labels["storage.s3.region"],
-			AccessKey: labels["storage.s3.access_key"],
-			SecretKey: labels["storage.s3.secret_key"],
+			Bucket:    labels["bucket"],
+			Region:    labels["region"],
+			AccessKey: labels["access_key"],
+			SecretKey: secret.String(labels["secret_key"]),
+		}
+	case "gcs":
+		chunkSize, err := parseIntWithDefault(labels, "chunk_size", 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse GCS chunk size: %v", err)
+		}
+		storageConfig.GCS = &storage.GCSStorageConfig{
+			Bucket:          labels["bucket"],
+			CredentialsFile: labels["credentials_file"],
+			CredentialsJSON: secret.String(labels["credentials_json"]),
+			Endpoint:        labels["endpoint"],
+			ChunkSize:       chunkSize,
+			Metadata:        extractPrefixed(labels, "metadata."),
+		}
+	case "azure":
+		blockSize, err := parseIntWithDefault(labels, "block_size", 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse azure block size: %v", err)
+		}
+		storageConfig.Azure = &storage.AzureStorageConfig{
+			AccountName:      labels["account_name"],
+			AccountKey:       secret.String(labels["account_key"]),
+			SASToken:         secret.String(labels["sas_token"]),
+			ConnectionString: secret.String(labels["connection_string"]),
+			Endpoint:         labels["endpoint"],
+			Container:        labels["container"],
+			AccessTier:       labels["access_tier"],
+			BlockSize:        int64(blockSize),
+		}
+	case "webdav":
+		chunkSize, err := parseIntWithDefault(labels, "chunk_size", 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse WebDAV chunk size: %v", err)
+		}
+		storageConfig.WebDAV = &storage.WebDAVStorageConfig{
+			URL:        labels["url"],
+			Username:   labels["username"],
+			Password:   secret.String(labels["password"]),
+			Auth:       labels["auth"],
+			ChunkSize:  int64(chunkSize),
+			UploadsURL: labels["uploads_url"],
 		}
 	default:
 		return nil, fmt.Errorf("invalid storage: %s", storageType)
@@ -81,13 +149,58 @@ func buildStorageConfig(labels map[string]string) (*storage.StorageConfig, error
 	return storageConfig, nil
 }
 
-func buildProviderConfig(labels map[string]string) *provider.ProviderConfig {
+// buildDestinations resolves the comma separated destination names in
+// backup.storage. Each destination reads its settings from
+// backup.storage.<name>.*, and its type defaults to the name itself so that
+// "backup.storage: s3" keeps working with backup.storage.s3.* labels.
+func buildDestinations(labels map[string]string) ([]storage.Destination, error) {
+	var destinations []storage.Destination
+	seen := make(map[string]bool)
+
+	for _, name := range strings.Split(getStringWithDefault(labels, "storage", "local"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		destLabels := extractPrefixed(labels, "storage."+name+".")
+		storageType := getStringWithDefault(destLabels, "type", name)
+
+		storageConfig, err := buildStorageConfig(storageType, destLabels)
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %v", name, err)
+		}
+
+		destinations = append(destinations, storage.Destination{
+			Name:   name,
+			Type:   storageType,
+			Config: storageConfig,
+		})
+	}
+
+	if len(destinations) == 0 {
+		return nil, fmt.Errorf("no storage destinations configured")
+	}
+
+	return destinations, nil
+}
+
+func buildProviderConfig(labels map[string]string) (*provider.ProviderConfig, error) {
 	providerType := getStringWithDefault(labels, "provider", "local")
 
+	providerLabels, err := secret.ResolveMap(extractPrefixed(labels, "provider."+providerType+"."), "password")
+	if err != nil {
+		return nil, err
+	}
+
 	providerConfig := &provider.ProviderConfig{}
 	switch providerType {
 	case "postgres":
-		providerConfig.Postgres = &provider.PostgresProviderConfig{}
+		providerConfig.Postgres = &provider.PostgresProviderConfig{
+			User:     providerLabels["user"],
+			Password: secret.String(providerLabels["password"]),
+		}
 	case "redis":
 		providerConfig.Redis = &provider.RedisProviderConfig{}
 	case "clickhouse":
@@ -98,162 +211,305 @@ func buildProviderConfig(labels map[string]string) *provider.ProviderConfig {
 		providerConfig.RabbitMQ = &provider.RabbitMQProviderConfig{}
 	}
 
-	return providerConfig
+	return providerConfig, nil
 }
 
-func parseConfig(labels map[string]string) (*scheduler.Config, error) {
-	if labels["enabled"] != "true" {
-		return &scheduler.Config{Enabled: false}, nil
+func buildNotifiers(global *config.Config, labels map[string]string) ([]notifier.Config, error) {
+	var notifiers []notifier.Config
+	for _, name := range strings.Split(labels["notify"], ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		values := make(map[string]string)
+		if defined, ok := global.Notifier(name); ok {
+			for key, value := range defined {
+				values[key] = value
+			}
+		}
+		for key, value := range extractPrefixed(labels, "notify."+name+".") {
+			values[key] = value
+		}
+		if len(values) == 0 {
+			return nil, fmt.Errorf("unknown notifier: %s", name)
+		}
+
+		values, err := secret.ResolveMap(values, "url")
+		if err != nil {
+			return nil, fmt.Errorf("notifier %s: %v", name, err)
+		}
+
+		c := notifier.ParseConfig(name, values)
+		if _, err := notifier.New(c); err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, c)
 	}
 
-	timeZone := getStringWithDefault(labels, "time_zone", "UTC")
+	return notifiers, nil
+}
+
+// parseSchedule reads the frequency, time and day labels of a schedule.
+func parseSchedule(labels map[string]string, defaultTimeZone string) (scheduler.Config, error) {
+	timeZone := getStringWithDefault(labels, "time_zone", defaultTimeZone)
 	tz, err := time.LoadLocation(timeZone)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load time zone: %v", err)
+		return scheduler.Config{}, fmt.Errorf("failed to load time zone: %v", err)
 	}
 
 	frequency, err := validateFrequency(labels["frequency"])
 	if err != nil {
-		return nil, err
+		return scheduler.Config{}, err
 	}
 
 	dayOfMonth, err := parseIntWithDefault(labels, "day_of_month", 1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse day of month: %v", err)
+		return scheduler.Config{}, fmt.Errorf("failed to parse day of month: %v", err)
 	}
 
 	dayOfWeek, err := parseIntWithDefault(labels, "day_of_week", 0)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse day of week: %v", err)
+		return scheduler.Config{}, fmt.Errorf("failed to parse day of week: %v", err)
 	}
 
 	dayOfYear, err := parseIntWithDefault(labels, "day_of_year", 1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse day of year: %v", err)
+		return scheduler.Config{}, fmt.Errorf("failed to parse day of year: %v", err)
 	}
 
-	storageConfig, err := buildStorageConfig(labels)
+	spread, err := parseDurationWithDefault(labels, "spread", 0)
 	if err != nil {
-		return nil, err
+		return scheduler.Config{}, fmt.Errorf("failed to parse spread: %v", err)
 	}
 
-	return &scheduler.Config{
-		Enabled:        true,
-		Frequency:      frequency,
-		Time:           getStringWithDefault(labels, "time", "00:00"),
-		TimeZone:       tz,
-		DayOfMonth:     dayOfMonth,
-		DayOfWeek:      dayOfWeek,
-		DayOfYear:      dayOfYear,
-		Provider:       getStringWithDefault(labels, "provider", "local"),
-		Location:       getStringWithDefault(labels, "location", "local"),
-		StorageConfig:  storageConfig,
-		ProviderConfig: buildProviderConfig(labels),
+	jitter, err := parseDurationWithDefault(labels, "jitter", 0)
+	if err != nil {
+		return scheduler.Config{}, fmt.Errorf("failed to parse jitter: %v", err)
+	}
+
+	overlap, err := scheduler.ParseOverlapPolicy(getStringWithDefault(labels, "overlap", string(scheduler.OverlapSkip)))
+	if err != nil {
+		return scheduler.Config{}, err
+	}
+
+	return scheduler.Config{
+		Frequency:  frequency,
+		Time:       getStringWithDefault(labels, "time", "00:00"),
+		TimeZone:   tz,
+		DayOfMonth: dayOfMonth,
+		DayOfWeek:  dayOfWeek,
+		DayOfYear:  dayOfYear,
+		Spread:     spread,
+		Jitter:     jitter,
+		Overlap:    overlap,
 	}, nil
 }
 
-func main() {
-	log := logger.New(logger.DEBUG)
-	session := log.NewSession("[main] ")
+// parseVerify reads the backup.verify.* labels. Verification is enabled by
+// giving it a frequency, and shares the job's time zone unless overridden.
+func parseVerify(labels map[string]string, defaultTimeZone string) (*scheduler.VerifyConfig, error) {
+	verifyLabels := extractPrefixed(labels, "verify.")
+	if verifyLabels["frequency"] == "" {
+		return nil, nil
+	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	schedule, err := parseSchedule(verifyLabels, defaultTimeZone)
 	if err != nil {
-		session.Error("Failed to create Docker client: %v", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("invalid verify schedule: %v", err)
+	}
+
+	timeout, err := time.ParseDuration(getStringWithDefault(verifyLabels, "timeout", "30m"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse verify timeout: %v", err)
 	}
 
-	mgr := manager.New(log)
+	return &scheduler.VerifyConfig{
+		Schedule: schedule,
+		Command:  verifyLabels["command"],
+		Timeout:  timeout,
+	}, nil
+}
 
-	ctx := context.Background()
-	containers, err := cli.ContainerList(ctx, container.ListOptions{})
+// parseRetry reads the backup.retry.* labels. Without them a failed run is
+// not retried.
+func parseRetry(labels map[string]string) (retry.Policy, error) {
+	attempts, err := parseIntWithDefault(labels, "retry.attempts", 1)
 	if err != nil {
-		session.Error("Failed to list containers: %v", err)
-		os.Exit(1)
+		return retry.Policy{}, fmt.Errorf("failed to parse retry attempts: %v", err)
+	}
+	if attempts < 1 {
+		return retry.Policy{}, fmt.Errorf("retry attempts must be at least 1")
 	}
 
-	for _, container := range containers {
-		labels := extractLabels(container.Labels)
-		if err := handleContainer(ctx, cli, container.ID, labels, mgr, log); err != nil {
-			session.Error("Failed to handle container %s: %v", container.ID, err)
-		}
+	backoff, err := parseDurationWithDefault(labels, "retry.backoff", time.Minute)
+	if err != nil {
+		return retry.Policy{}, fmt.Errorf("failed to parse retry backoff: %v", err)
 	}
 
-	filterArgs := filters.NewArgs()
-	filterArgs.Add("type", "container")
-	filterArgs.Add("event", "start")
-	filterArgs.Add("event", "die")
-
-	eventsCh, errCh := cli.Events(ctx, events.ListOptions{
-		Filters: filterArgs,
-	})
-
-	for {
-		select {
-		case event := <-eventsCh:
-			containerID := event.Actor.ID
-			labels := extractLabels(event.Actor.Attributes)
-
-			switch event.Action {
-			case "start":
-				if err := handleContainer(ctx, cli, containerID, labels, mgr, log); err != nil {
-					session.Error("Failed to handle container start %s: %v", containerID, err)
-				}
-			case "die":
-				mgr.RemoveScheduler(containerID)
-				session.Info("Removed scheduler for container: %s", containerID)
-			}
+	maxDelay, err := parseDurationWithDefault(labels, "retry.max_delay", 30*time.Minute)
+	if err != nil {
+		return retry.Policy{}, fmt.Errorf("failed to parse retry max delay: %v", err)
+	}
 
-		case err := <-errCh:
-			session.Error("Error watching events: %v", err)
-			time.Sleep(5 * time.Second)
-		}
+	if backoff < 0 || maxDelay < 0 {
+		return retry.Policy{}, fmt.Errorf("retry delays must not be negative")
 	}
+
+	return retry.Policy{Attempts: attempts, Backoff: backoff, MaxDelay: maxDelay}, nil
 }
 
-func handleContainer(ctx context.Context, cli *client.Client, containerID string, labels map[string]string, mgr *manager.Manager, log *logger.Logger) error {
-	config, err := parseConfig(labels)
+func parseConfig(global *config.Config, labels map[string]string) (*scheduler.Config, error) {
+	// Only labels can enable a container; global defaults never opt a
+	// container in on their own.
+	if labels["enabled"] != "true" {
+		return &scheduler.Config{Enabled: false}, nil
+	}
+
+	labels = global.Merge(labels)
+
+	schedule, err := parseSchedule(labels, "UTC")
 	if err != nil {
-		return fmt.Errorf("failed to parse config: %v", err)
+		return nil, err
 	}
 
-	if !config.Enabled {
-		return nil
+	destinations, err := buildDestinations(labels)
+	if err != nil {
+		return nil, err
 	}
 
-	session := log.NewSession("[backup] ")
+	policy, err := storage.ParsePolicy(getStringWithDefault(labels, "storage.policy", string(storage.PolicyAll)))
+	if err != nil {
+		return nil, err
+	}
 
-	json, err := json.Marshal(config)
+	providerConfig, err := buildProviderConfig(labels)
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %v", err)
+		return nil, err
 	}
 
-	session.Info("Config for container %s: %s", containerID, string(json))
+	notifiers, err := buildNotifiers(global, labels)
+	if err != nil {
+		return nil, err
+	}
 
-	sch, err := scheduler.New(*config, func() {
-		session.Info("Executing backup task for container: %s", containerID)
+	verify, err := parseVerify(labels, schedule.TimeZone.String())
+	if err != nil {
+		return nil, err
+	}
 
-		pCtx := &provider.ProviderContext{
-			Session:     session,
-			Client:      cli,
-			ContainerID: containerID,
-		}
+	retryPolicy, err := parseRetry(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := parseDurationWithDefault(labels, "timeout", 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse timeout: %v", err)
+	}
+	if timeout < 0 {
+		return nil, fmt.Errorf("timeout must not be negative")
+	}
+
+	priority, err := parseIntWithDefault(labels, "priority", 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid priority: %v", err)
+	}
 
-		p := provider.NewProvider(pCtx, config.Provider)
+	namingTemplate := getStringWithDefault(labels, "naming", naming.DefaultTemplate)
+	if _, err := naming.Parse(namingTemplate); err != nil {
+		return nil, err
+	}
 
-		storage := storage.NewStorage(pCtx, config.Location, config.StorageConfig)
+	return &scheduler.Config{
+		Enabled:        true,
+		Frequency:      schedule.Frequency,
+		Time:           schedule.Time,
+		TimeZone:       schedule.TimeZone,
+		DayOfMonth:     schedule.DayOfMonth,
+		DayOfWeek:      schedule.DayOfWeek,
+		DayOfYear:      schedule.DayOfYear,
+		Spread:         schedule.Spread,
+		Jitter:         schedule.Jitter,
+		Overlap:        schedule.Overlap,
+		Provider:       getStringWithDefault(labels, "provider", "local"),
+		Naming:         namingTemplate,
+		Priority:       priority,
+		Retry:          retryPolicy,
+		Timeout:        timeout,
+		Destinations:   destinations,
+		StoragePolicy:  policy,
+		ProviderConfig: providerConfig,
+		Notifiers:      notifiers,
+		Verify:         verify,
+	}, nil
+}
 
-		if err := p.Backup(ctx, storage); err != nil {
-			session.Error("Failed to backup container %s: %v", containerID, err)
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Exit(runValidate(os.Args[2:]))
+		case "backup":
+			os.Exit(runBackupCommand(os.Args[2:]))
+		case "list":
+			os.Exit(runListCommand(os.Args[2:]))
+		case "show":
+			os.Exit(runShowCommand(os.Args[2:]))
+		case "rebuild":
+			os.Exit(runRebuildCommand(os.Args[2:]))
+		case "health":
+			os.Exit(runHealthCommand(os.Args[2:]))
 		}
-	}, scheduler.WithLogger(log))
+	}
+
+	dryRun := flag.Bool("dry-run", false, "run checks on schedule instead of writing backups")
+	flag.Parse()
+
+	log, err := logger.FromEnv(logger.DEBUG)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
+	// Libraries logging through log/slog share our output and format.
+	slog.SetDefault(log.Slog())
+	session := log.NewSession("[main] ")
+
+	d, err := newDaemon(log, *dryRun)
 	if err != nil {
-		return fmt.Errorf("failed to create scheduler: %v", err)
+		session.Error("%v", err)
+		os.Exit(1)
+	}
+	if d.dryRun {
+		session.Info("Dry run mode: scheduled runs only check config, storage and providers")
+	}
+
+	// Signals stop the event loop; runs use their own context so they can
+	// drain before being cancelled.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	runCtx, cancelRuns := context.WithCancel(context.Background())
+	defer cancelRuns()
+
+	go d.reportStatus(ctx, session)
+	if d.elector != nil {
+		go d.elect(ctx)
+	}
+	if d.global.MetricsAddr != "" {
+		go d.serveMetrics(ctx, session, d.global.MetricsAddr)
 	}
 
-	if err := sch.Start(); err != nil {
-		return fmt.Errorf("failed to start scheduler: %v", err)
+	var wg sync.WaitGroup
+	for _, h := range d.hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.watch(ctx, runCtx, h)
+		}()
 	}
+	wg.Wait()
 
-	mgr.AddScheduler(containerID, sch)
-	return nil
+	// A second signal terminates immediately.
+	stop()
+	d.shutdown(session, cancelRuns)
 }
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/lease"
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/pool"
+)
+
+// statusInterval is how often the daemon writes its status file. The health
+// command considers the daemon dead once the file is a few intervals old.
+const statusInterval = 15 * time.Second
+
+// status is what the daemon reports about itself to the health command and
+// the /health endpoint.
+type status struct {
+	UpdatedAt time.Time    `json:"updated_at"`
+	Hosts     []hostStatus `json:"hosts"`
+	Pool      pool.Stats   `json:"pool"`
+	// Leader is set when leader election is on.
+	Leader *lease.Status `json:"leader,omitempty"`
+}
+
+// healthy reports whether at least one host, or with all every host, is
+// connected.
+func (s *status) healthy(all bool) bool {
+	connected := 0
+	for _, h := range s.Hosts {
+		if h.Connected {
+			connected++
+		}
+	}
+	if all {
+		return connected == len(s.Hosts)
+	}
+	return connected > 0
+}
+
+func statusPath() string {
+	if path := os.Getenv("BACKUP_STATUS"); path != "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(catalogPath()), "status.json")
+}
+
+func (d *daemon) status() *status {
+	s := &status{UpdatedAt: time.Now(), Pool: d.pool.Stats()}
+	if d.elector != nil {
+		leader := d.elector.Status()
+		s.Leader = &leader
+	}
+	for _, h := range d.hosts {
+		s.Hosts = append(s.Hosts, h.currentStatus())
+	}
+	return s
+}
+
+// reportStatus writes the status file until ctx is done, so the health
+// command can check on the daemon from a separate process.
+func (d *daemon) reportStatus(ctx context.Context, session *logger.Session) {
+	path := statusPath()
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := writeStatus(path, d.status()); err != nil {
+			session.Warn("Failed to write status file: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeStatus(path string, s *status) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Rename so readers never see a partial file.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readStatus(path string) (*status, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s status
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode status: %v", err)
+	}
+	return &s, nil
+}
+
+// runHealthCommand checks the status file of a running daemon. It fails if
+// the daemon stopped updating it or, by default, can't reach any host.
+func runHealthCommand(args []string) int {
+	fs := flag.NewFlagSet("health", flag.ExitOnError)
+	all := fs.Bool("all", false, "require every host to be connected")
+	jsonOutput := fs.Bool("json", false, "print the status as JSON")
+	fs.Parse(args)
+
+	s, err := readStatus(statusPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unhealthy: %v\n", err)
+		return 1
+	}
+
+	if *jsonOutput {
+		printJSON(s)
+	} else {
+		for _, h := range s.Hosts {
+			state := "connected"
+			if !h.Connected {
+				state = "disconnected: " + h.Error
+			}
+			if h.Engine != "" {
+				state = h.Engine + ", " + state
+			}
+			fmt.Printf("%s: %s since %s, %d jobs\n", h.Name, state, h.Since.Format(time.RFC3339), h.Jobs)
+		}
+		if l := s.Leader; l != nil {
+			switch {
+			case l.Leading:
+				fmt.Printf("leader: this agent (%s), token %d\n", l.ID, l.Token)
+			case l.Leader != "":
+				fmt.Printf("leader: %s, token %d; this agent (%s) is standing by\n", l.Leader, l.Token, l.ID)
+			default:
+				fmt.Printf("leader: none; this agent is %s\n", l.ID)
+			}
+			if l.Error != "" {
+				fmt.Printf("leader election error: %s\n", l.Error)
+			}
+		}
+	}
+
+	if age := time.Since(s.UpdatedAt); age > 4*statusInterval {
+		fmt.Fprintf(os.Stderr, "unhealthy: status is %v old\n", age.Round(time.Second))
+		return 1
+	}
+	if !s.healthy(*all) {
+		fmt.Fprintln(os.Stderr, "unhealthy: hosts are disconnected")
+		return 1
+	}
+	return 0
+}
+
+// serveMetrics serves /metrics in the Prometheus text format and /health
+// with the daemon's status until ctx is done.
+func (d *daemon) serveMetrics(ctx context.Context, session *logger.Session, addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		d.writeMetrics(w)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		s := d.status()
+		w.Header().Set("Content-Type", "application/json")
+		if !s.healthy(r.URL.Query().Get("all") == "true") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(s)
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	session.Info("Serving metrics on %s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		session.Error("Metrics server failed: %v", err)
+	}
+}
+
+func (d *daemon) writeMetrics(w http.ResponseWriter) {
+	s := d.status()
+
+	fmt.Fprintln(w, "# HELP docker_auto_backup_host_up Whether the Docker host is reachable.")
+	fmt.Fprintln(w, "# TYPE docker_auto_backup_host_up gauge")
+	for _, h := range s.Hosts {
+		up := 0
+		if h.Connected {
+			up = 1
+		}
+		fmt.Fprintf(w, "docker_auto_backup_host_up{host=%q} %d\n", h.Name, up)
+	}
+
+	fmt.Fprintln(w, "# HELP docker_auto_backup_host_jobs Jobs scheduled on the Docker host.")
+	fmt.Fprintln(w, "# TYPE docker_auto_backup_host_jobs gauge")
+	for _, h := range s.Hosts {
+		fmt.Fprintf(w, "docker_auto_backup_host_jobs{host=%q} %d\n", h.Name, h.Jobs)
+	}
+
+	if s.Leader != nil {
+		leading := 0
+		if s.Leader.Leading {
+			leading = 1
+		}
+		fmt.Fprintln(w, "# HELP docker_auto_backup_leader Whether this agent holds the leader lease.")
+		fmt.Fprintln(w, "# TYPE docker_auto_backup_leader gauge")
+		fmt.Fprintf(w, "docker_auto_backup_leader{id=%q} %d\n", s.Leader.ID, leading)
+	}
+
+	fmt.Fprintln(w, "# HELP docker_auto_backup_runs_running Backups and verifications running.")
+	fmt.Fprintln(w, "# TYPE docker_auto_backup_runs_running gauge")
+	fmt.Fprintf(w, "docker_auto_backup_runs_running %d\n", s.Pool.Running)
+	fmt.Fprintln(w, "# HELP docker_auto_backup_runs_queued Backups and verifications waiting for a slot.")
+	fmt.Fprintln(w, "# TYPE docker_auto_backup_runs_queued gauge")
+	fmt.Fprintf(w, "docker_auto_backup_runs_queued %d\n", s.Pool.Queued)
+	fmt.Fprintln(w, "# HELP docker_auto_backup_runs_started_total Backups and verifications started.")
+	fmt.Fprintln(w, "# TYPE docker_auto_backup_runs_started_total counter")
+	fmt.Fprintf(w, "docker_auto_backup_runs_started_total %d\n", s.Pool.Started)
+}
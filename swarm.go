@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/swarm"
+)
+
+// Labels Swarm sets on the containers of service tasks.
+const (
+	swarmServiceIDLabel   = "com.docker.swarm.service.id"
+	swarmServiceNameLabel = "com.docker.swarm.service.name"
+	swarmTaskIDLabel      = "com.docker.swarm.task.id"
+	swarmTaskNameLabel    = "com.docker.swarm.task.name"
+)
+
+// swarmTask returns the service and slot of a Swarm task's container from
+// its raw labels. Tasks of global services have no slot and report zero.
+func swarmTask(labels map[string]string) (service string, slot int, ok bool) {
+	service = labels[swarmServiceNameLabel]
+	if service == "" {
+		return "", 0, false
+	}
+
+	// Task names are <service>.<slot>.<task ID> for replicated services
+	// and <service>.<node ID>.<task ID> for global ones.
+	rest := strings.TrimPrefix(labels[swarmTaskNameLabel], service+".")
+	slotText, _, _ := strings.Cut(rest, ".")
+	slot, _ = strconv.Atoi(slotText)
+	return service, slot, true
+}
+
+// swarmJobName names the job of a task after its service.
+func swarmJobName(labels map[string]string) (string, bool) {
+	service, _, ok := swarmTask(labels)
+	return service, ok
+}
+
+// swarmView is what a node knows about the cluster. Only managers can list
+// services and tasks; on workers the view is empty and ownership is decided
+// from local containers alone.
+type swarmView struct {
+	// services holds the labels of all services by ID.
+	services map[string]map[string]string
+	// owners holds the ID of the task to back up by service ID.
+	owners map[string]string
+	// leader is set on the node leading the managers.
+	leader bool
+}
+
+// ownsTask reports whether this agent backs up the container with the given
+// raw labels. Every node runs an agent, but a service must only be backed up
+// once across the cluster and commands can only be executed on the node
+// running the task.
+//
+// Managers see all tasks and own a task only if it was chosen as the
+// service's owner. Workers can't, so they own the tasks in slot 1 of
+// replicated services; during a start-first update the old and new task of
+// slot 1 may then both be backed up for a moment. Global services are left
+// to the leader's agent, as workers can't tell which of their tasks it
+// chose.
+func (v *swarmView) ownsTask(labels map[string]string) bool {
+	_, slot, ok := swarmTask(labels)
+	if !ok {
+		return true
+	}
+	if v.owners != nil {
+		return v.owners[labels[swarmServiceIDLabel]] == labels[swarmTaskIDLabel]
+	}
+	return slot == 1
+}
+
+// swarmView returns what this node knows about the cluster.
+func (h *host) swarmView(ctx context.Context) (*swarmView, error) {
+	info, err := h.cli.Info(ctx)
+	if err != nil {
+		return &swarmView{}, fmt.Errorf("failed to get Docker info: %v", err)
+	}
+	if !info.Swarm.ControlAvailable {
+		return &swarmView{}, nil
+	}
+
+	services, err := h.cli.ServiceList(ctx, types.ServiceListOptions{})
+	if err != nil {
+		return &swarmView{}, fmt.Errorf("failed to list services: %v", err)
+	}
+	tasks, err := h.cli.TaskList(ctx, types.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("desired-state", "running")),
+	})
+	if err != nil {
+		return &swarmView{}, fmt.Errorf("failed to list tasks: %v", err)
+	}
+	node, _, err := h.cli.NodeInspectWithRaw(ctx, info.Swarm.NodeID)
+	if err != nil {
+		return &swarmView{}, fmt.Errorf("failed to inspect node: %v", err)
+	}
+
+	v := &swarmView{
+		services: make(map[string]map[string]string, len(services)),
+		leader:   node.ManagerStatus != nil && node.ManagerStatus.Leader,
+	}
+	for _, s := range services {
+		v.services[s.ID] = s.Spec.Labels
+	}
+	v.owners = taskOwners(tasks, info.Swarm.NodeID, v.leader)
+	return v, nil
+}
+
+// taskOwners chooses the task to back up for each service among tasks that
+// are meant to keep running. Of a replicated service, that's the newest task
+// in the lowest slot, so an update replacing a task with a newer one hands
+// the backups over right away. Of a global service, it's the task on this
+// node if it leads the managers, as the leader's agent can act on that
+// choice; other nodes own none.
+func taskOwners(tasks []swarm.Task, nodeID string, leader bool) map[string]string {
+	chosen := make(map[string]swarm.Task)
+	for _, t := range tasks {
+		if t.DesiredState != swarm.TaskStateRunning {
+			continue
+		}
+		if t.Slot == 0 {
+			if leader && t.NodeID == nodeID {
+				chosen[t.ServiceID] = t
+			}
+			continue
+		}
+		cur, ok := chosen[t.ServiceID]
+		if !ok || t.Slot < cur.Slot || t.Slot == cur.Slot && newerTask(t, cur) {
+			chosen[t.ServiceID] = t
+		}
+	}
+
+	owners := make(map[string]string, len(chosen))
+	for service, t := range chosen {
+		owners[service] = t.ID
+	}
+	return owners
+}
+
+func newerTask(a, b swarm.Task) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+// taskLabels merges the backup.* labels of a task's service under the
+// container's own raw labels, which take precedence.
+func taskLabels(containerLabels map[string]string, services map[string]map[string]string) map[string]string {
+	service, ok := services[containerLabels[swarmServiceIDLabel]]
+	if !ok {
+		return containerLabels
+	}
+
+	labels := make(map[string]string, len(containerLabels)+len(service))
+	for key, value := range service {
+		if strings.HasPrefix(key, "backup.") {
+			labels[key] = value
+		}
+	}
+	for key, value := range containerLabels {
+		labels[key] = value
+	}
+	return labels
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+)
+
+// Well-known development account shipped with the Azurite emulator.
+const (
+	azuriteAccountName = "devstoreaccount1"
+	azuriteAccountKey  = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+func TestAzureStorage(t *testing.T) {
+	endpoint := os.Getenv("AZURITE_BLOB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("AZURITE_BLOB_ENDPOINT not set, e.g. http://127.0.0.1:10000/devstoreaccount1")
+	}
+
+	cred, err := azblob.NewSharedKeyCredential(azuriteAccountName, azuriteAccountKey)
+	if err != nil {
+		t.Fatalf("failed to create credential: %v", err)
+	}
+	admin, err := azblob.NewClientWithSharedKeyCredential(endpoint, cred, nil)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	ctx := context.Background()
+	container := strings.ToLower(strings.ReplaceAll(t.Name(), "_", "-"))
+	if _, err := admin.CreateContainer(ctx, container, nil); err != nil {
+		t.Fatalf("failed to create container: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.DeleteContainer(context.Background(), container, nil)
+	})
+
+	azure, err := storage.NewAzureStorage(storage.AzureStorageConfig{
+		AccountName: azuriteAccountName,
+		AccountKey:  azuriteAccountKey,
+		Endpoint:    endpoint,
+		Container:   container,
+		AccessTier:  "Cool",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := strings.Repeat("backup data ", 256*1024)
+
+	// io.MultiReader hides the length so the upload has to be streamed in blocks.
+	if err := azure.Put(ctx, "postgres/backup_1.sql", io.MultiReader(strings.NewReader(content))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reader, err := azure.Get(ctx, "postgres/backup_1.sql")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	_, err = io.Copy(buf, reader)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("failed to read blob: %v", err)
+	}
+	if buf.String() != content {
+		t.Errorf("content mismatch: got %d bytes, expected %d", buf.Len(), len(content))
+	}
+
+	objects, err := azure.List(ctx, "postgres/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objects) != 1 || objects[0].Size != int64(len(content)) {
+		t.Fatalf("expected a single blob of %d bytes, got %v", len(content), objects)
+	}
+
+	if err := azure.Delete(ctx, "postgres/backup_1.sql"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	objects, err = azure.List(ctx, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("expected no blobs after delete, got %v", objects)
+	}
+}
+
+func TestNewAzureStorage_Validation(t *testing.T) {
+	tests := []struct {
+		name   string
+		config storage.AzureStorageConfig
+	}{
+		{
+			name:   "missing container",
+			config: storage.AzureStorageConfig{ConnectionString: "UseDevelopmentStorage=true"},
+		},
+		{
+			name:   "missing credentials",
+			config: storage.AzureStorageConfig{AccountName: "account", Container: "backups"},
+		},
+		{
+			name: "invalid access tier",
+			config: storage.AzureStorageConfig{
+				AccountName: "account",
+				SASToken:    "sv=2022-11-02&sig=abc",
+				Container:   "backups",
+				AccessTier:  "Frozen",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := storage.NewAzureStorage(tt.config); err == nil {
+				t.Errorf("expected error, got nil")
+			}
+		})
+	}
+}
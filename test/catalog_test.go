@@ -0,0 +1,116 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/catalog"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+)
+
+func TestCatalogRecordAndList(t *testing.T) {
+	cat, err := catalog.Open(t.TempDir() + "/catalog.db")
+	if err != nil {
+		t.Fatalf("failed to open catalog: %v", err)
+	}
+
+	base := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	entries := []catalog.Entry{
+		{Job: "db", StartedAt: base, Status: catalog.Success, Object: "backup_1.sql"},
+		{Job: "cache", StartedAt: base.Add(time.Hour), Status: catalog.Failure, Error: "boom"},
+		{Job: "db", StartedAt: base.Add(2 * time.Hour), Status: catalog.Success, Object: "backup_2.sql"},
+	}
+	for i := range entries {
+		if err := cat.Record(&entries[i]); err != nil {
+			t.Fatalf("failed to record entry: %v", err)
+		}
+	}
+
+	all, err := cat.List(catalog.Filter{})
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(all) != 3 || all[0].Object != "backup_2.sql" {
+		t.Fatalf("expected 3 entries newest first, got %+v", all)
+	}
+
+	db, err := cat.List(catalog.Filter{Job: "db", Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(db) != 1 || db[0].Object != "backup_2.sql" {
+		t.Errorf("expected latest db run, got %+v", db)
+	}
+
+	failed, err := cat.List(catalog.Filter{Status: catalog.Failure})
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(failed) != 1 || failed[0].Job != "cache" {
+		t.Errorf("expected the failed cache run, got %+v", failed)
+	}
+
+	got, err := cat.Get(entries[0].ID[:len(entries[0].ID)-2])
+	if err != nil {
+		t.Fatalf("failed to get by prefix: %v", err)
+	}
+	if got.Object != "backup_1.sql" {
+		t.Errorf("Get() = %+v", got)
+	}
+
+	if _, err := cat.Get("19990101"); !errors.Is(err, catalog.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCatalogRebuildFromManifests(t *testing.T) {
+	ctx := context.Background()
+	local := storage.NewLocalStorage(storage.LocalStorageConfig{RootPath: t.TempDir()})
+
+	tracker := catalog.Track(&local)
+	if err := tracker.Put(ctx, "backup_1.sql", strings.NewReader("hello")); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+	object, size, sum := tracker.Written()
+	if object != "backup_1.sql" || size != 5 {
+		t.Errorf("Written() = %q, %d", object, size)
+	}
+	if sum != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("unexpected checksum %s", sum)
+	}
+
+	entry := &catalog.Entry{
+		ID:       catalog.NewID(time.Now()),
+		Job:      "db",
+		Object:   object,
+		Size:     size,
+		Checksum: sum,
+		Status:   catalog.Success,
+	}
+	if err := catalog.WriteManifest(ctx, &local, entry); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+
+	cat, err := catalog.Open(t.TempDir() + "/catalog.db")
+	if err != nil {
+		t.Fatalf("failed to open catalog: %v", err)
+	}
+	n, err := cat.Rebuild(ctx, &local)
+	if err != nil {
+		t.Fatalf("failed to rebuild: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 imported run, got %d", n)
+	}
+
+	got, err := cat.Get(entry.ID)
+	if err != nil {
+		t.Fatalf("failed to get rebuilt entry: %v", err)
+	}
+	if got.Checksum != sum || got.Job != "db" {
+		t.Errorf("rebuilt entry = %+v", got)
+	}
+}
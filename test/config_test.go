@@ -0,0 +1,229 @@
+package test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/config"
+)
+
+const testConfig = `
+defaults:
+  frequency: daily
+  time: "02:00"
+  storage: offsite
+  retry:
+    attempts: 3
+
+storages:
+  offsite:
+    type: s3
+    bucket: backups
+    region: eu-central-1
+  gcs:
+    bucket: archive
+    chunk_size: 262144
+    metadata:
+      team: platform
+
+notifiers:
+  ops:
+    type: webhook
+    url: https://hooks.example.com
+    headers:
+      Authorization: Bearer token
+`
+
+func TestConfig_Parse(t *testing.T) {
+	c, err := config.Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantDefaults := map[string]string{
+		"frequency":      "daily",
+		"time":           "02:00",
+		"storage":        "offsite",
+		"retry.attempts": "3",
+	}
+	if !reflect.DeepEqual(c.Defaults, wantDefaults) {
+		t.Errorf("defaults = %v, want %v", c.Defaults, wantDefaults)
+	}
+
+	wantGCS := map[string]string{
+		"bucket":        "archive",
+		"chunk_size":    "262144",
+		"metadata.team": "platform",
+	}
+	if !reflect.DeepEqual(c.Storages["gcs"], wantGCS) {
+		t.Errorf("gcs storage = %v, want %v", c.Storages["gcs"], wantGCS)
+	}
+
+	ops, ok := c.Notifier("ops")
+	if !ok || ops["headers.Authorization"] != "Bearer token" {
+		t.Errorf("unexpected notifier config: %v", ops)
+	}
+}
+
+func TestConfig_Merge(t *testing.T) {
+	c, err := config.Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	merged := c.Merge(map[string]string{
+		"enabled":                "true",
+		"time":                   "04:30",
+		"storage.offsite.region": "us-east-1",
+	})
+
+	tests := map[string]string{
+		"enabled":                "true",
+		"frequency":              "daily",
+		"time":                   "04:30",
+		"storage":                "offsite",
+		"storage.offsite.type":   "s3",
+		"storage.offsite.bucket": "backups",
+		"storage.offsite.region": "us-east-1",
+	}
+	for key, want := range tests {
+		if got := merged[key]; got != want {
+			t.Errorf("merged[%q] = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestConfig_LoadMissing(t *testing.T) {
+	c, err := config.Load("/nonexistent/config.yml", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Defaults) != 0 || len(c.Storages) != 0 {
+		t.Errorf("expected empty config, got %+v", c)
+	}
+
+	if _, err := config.Load("/nonexistent/config.yml", true); err == nil {
+		t.Errorf("expected error for required config file")
+	}
+}
+
+func TestConfig_Concurrency(t *testing.T) {
+	c, err := config.Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Concurrency.Max != config.DefaultMaxConcurrent || c.Concurrency.PerDestination != 0 {
+		t.Errorf("expected default concurrency, got %+v", c.Concurrency)
+	}
+
+	c, err = config.Parse([]byte("concurrency:\n  per_destination: 1\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Concurrency.Max != config.DefaultMaxConcurrent || c.Concurrency.PerDestination != 1 {
+		t.Errorf("expected per destination limit on top of the default, got %+v", c.Concurrency)
+	}
+
+	if _, err := config.Parse([]byte("concurrency:\n  max: -1\n")); err == nil {
+		t.Errorf("expected error for negative limit")
+	}
+}
+
+func TestConfig_ShutdownGrace(t *testing.T) {
+	c, err := config.Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.ShutdownGrace != config.DefaultShutdownGrace {
+		t.Errorf("expected default grace period, got %v", c.ShutdownGrace)
+	}
+
+	c, err = config.Parse([]byte("shutdown_grace: 90s\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.ShutdownGrace != 90*time.Second {
+		t.Errorf("expected 90s grace period, got %v", c.ShutdownGrace)
+	}
+}
+
+func TestConfig_ReconcileInterval(t *testing.T) {
+	c, err := config.Parse([]byte(testConfig))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.ReconcileInterval != config.DefaultReconcileInterval {
+		t.Errorf("expected default reconcile interval, got %v", c.ReconcileInterval)
+	}
+
+	c, err = config.Parse([]byte("reconcile_interval: 0s\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.ReconcileInterval != 0 {
+		t.Errorf("expected reconciling on events only, got %v", c.ReconcileInterval)
+	}
+
+	if _, err := config.Parse([]byte("reconcile_interval: -1m\n")); err == nil {
+		t.Errorf("expected an error for a negative interval")
+	}
+}
+
+func TestConfig_Hosts(t *testing.T) {
+	c, err := config.Parse([]byte(`
+metrics_addr: ":9102"
+hosts:
+  - name: web1
+    endpoint: tcp://10.0.0.5:2376
+    tls:
+      ca_file: /certs/ca.pem
+      cert_file: /certs/cert.pem
+      key_file: /certs/key.pem
+  - name: web2
+    endpoint: ssh://backup@10.0.0.6
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(c.Hosts) != 2 || c.Hosts[0].TLS == nil || c.Hosts[0].TLS.CAFile != "/certs/ca.pem" || c.Hosts[1].Endpoint != "ssh://backup@10.0.0.6" {
+		t.Errorf("unexpected hosts: %+v", c.Hosts)
+	}
+	if c.MetricsAddr != ":9102" {
+		t.Errorf("expected metrics address, got %q", c.MetricsAddr)
+	}
+
+	for _, invalid := range []string{
+		"hosts:\n  - endpoint: tcp://a:2375\n",
+		"hosts:\n  - name: a/b\n    endpoint: tcp://a:2375\n",
+		"hosts:\n  - name: a\n",
+		"hosts:\n  - name: a\n    endpoint: tcp://a:2375\n  - name: a\n    endpoint: tcp://b:2375\n",
+	} {
+		if _, err := config.Parse([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
+
+func TestConfig_LeaderElection(t *testing.T) {
+	c, err := config.Parse([]byte(testConfig + `
+leader_election:
+  storage: offsite
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.LeaderElection == nil || c.LeaderElection.Storage != "offsite" || c.LeaderElection.TTL != config.DefaultLeaseTTL {
+		t.Errorf("unexpected leader election: %+v", c.LeaderElection)
+	}
+
+	for _, invalid := range []string{
+		"leader_election:\n  ttl: 10s\n",
+		"leader_election:\n  storage: missing\n",
+		testConfig + "leader_election:\n  storage: offsite\n  ttl: 1s\n",
+	} {
+		if _, err := config.Parse([]byte(invalid)); err == nil {
+			t.Errorf("expected an error for %q", invalid)
+		}
+	}
+}
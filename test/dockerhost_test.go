@@ -0,0 +1,123 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bytekai/docker-auto-backup/internal/config"
+	"github.com/bytekai/docker-auto-backup/internal/dockerhost"
+	"github.com/docker/docker/api/types"
+)
+
+func TestDockerHostNewClient(t *testing.T) {
+	for _, endpoint := range []string{
+		"unix:///var/run/docker.sock",
+		"tcp://10.0.0.5:2375",
+		"ssh://backup@10.0.0.6:2222",
+	} {
+		cli, err := dockerhost.NewClient(config.Host{Name: "h", Endpoint: endpoint})
+		if err != nil {
+			t.Errorf("NewClient(%q): %v", endpoint, err)
+			continue
+		}
+		cli.Close()
+	}
+
+	for _, endpoint := range []string{"ftp://10.0.0.5", "ssh://", "://"} {
+		if _, err := dockerhost.NewClient(config.Host{Name: "h", Endpoint: endpoint}); err == nil {
+			t.Errorf("expected an error for %q", endpoint)
+		}
+	}
+}
+
+func TestDockerHostDetectPodman(t *testing.T) {
+	if _, err := os.Stat(dockerhost.DockerSocket); err == nil {
+		t.Skip("a Docker socket takes precedence on this machine")
+	}
+	t.Setenv("DOCKER_HOST", "")
+
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	if got := dockerhost.Detect(); got != "" && got != "unix:///run/podman/podman.sock" && !strings.HasPrefix(got, "unix:///run/user/") {
+		t.Errorf("Detect() without sockets = %q", got)
+	}
+
+	path := filepath.Join(dir, "podman", "podman.sock")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer l.Close()
+
+	if got := dockerhost.Detect(); got != "unix://"+path {
+		t.Errorf("Detect() = %q, expected the rootless Podman socket", got)
+	}
+
+	t.Setenv("DOCKER_HOST", "tcp://10.0.0.5:2375")
+	if got := dockerhost.Detect(); got != "" {
+		t.Errorf("Detect() = %q, expected DOCKER_HOST to take precedence", got)
+	}
+}
+
+func TestDockerHostEngine(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.41")
+		if !strings.HasSuffix(r.URL.Path, "/version") {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.Version{
+			Platform:   struct{ Name string }{Name: "linux/amd64/fedora-39"},
+			Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "4.9.3"}},
+			Version:    "4.9.3",
+		})
+	}))
+	defer srv.Close()
+
+	cli, err := dockerhost.NewClient(config.Host{Name: "h", Endpoint: "tcp://" + strings.TrimPrefix(srv.URL, "http://")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+
+	engine, version, err := dockerhost.Engine(context.Background(), cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if engine != "Podman Engine" || version != "4.9.3" || !dockerhost.IsPodman(engine) {
+		t.Errorf("Engine() = %q, %q", engine, version)
+	}
+	if dockerhost.IsPodman("Docker Engine - Community") {
+		t.Errorf("expected Docker not to be detected as Podman")
+	}
+}
+
+func TestDockerHostIsPodInfra(t *testing.T) {
+	tests := []struct {
+		image string
+		names []string
+		want  bool
+	}{
+		{"localhost/podman-pause:4.9.3-1700000000", []string{"/3f2a1b4c5d6e-infra"}, true},
+		{"registry.k8s.io/pause:3.9", []string{"/db-pod-infra"}, true},
+		{"quay.io/custom/infra-image:1", []string{"/3f2a1b4c5d6e-infra"}, true},
+		{"registry.example.com:5000/pause", []string{"/custom"}, true},
+		{"docker.io/library/postgres:16", []string{"/db"}, false},
+		{"registry.example.com:5000/app:pause", []string{"/app"}, false},
+	}
+	for _, tt := range tests {
+		if got := dockerhost.IsPodInfra(tt.image, tt.names); got != tt.want {
+			t.Errorf("IsPodInfra(%q, %q) = %v, want %v", tt.image, tt.names, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+)
+
+func newFakeGCS(t *testing.T, bucket string) *fakestorage.Server {
+	t.Helper()
+
+	server, err := fakestorage.NewServerWithOptions(fakestorage.Options{
+		Scheme: "http",
+		Host:   "127.0.0.1",
+		Writer: io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("failed to start fake GCS server: %v", err)
+	}
+	t.Cleanup(server.Stop)
+
+	server.CreateBucket(bucket)
+	return server
+}
+
+func TestGCSStorage(t *testing.T) {
+	server := newFakeGCS(t, "backups")
+
+	gcs, err := storage.NewGCSStorage(storage.GCSStorageConfig{
+		Bucket:    "backups",
+		Endpoint:  server.URL() + "/storage/v1/",
+		ChunkSize: 256 * 1024,
+		Metadata:  map[string]string{"source": "postgres"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	content := strings.Repeat("backup data ", 64*1024)
+
+	t.Run("resumable upload", func(t *testing.T) {
+		if err := gcs.Put(ctx, "postgres/backup_1.sql", strings.NewReader(content)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		obj, err := server.GetObject("backups", "postgres/backup_1.sql")
+		if err != nil {
+			t.Fatalf("object not stored: %v", err)
+		}
+		if obj.Metadata["source"] != "postgres" {
+			t.Errorf("expected metadata source=postgres, got %v", obj.Metadata)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		reader, err := gcs.Get(ctx, "postgres/backup_1.sql")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		defer reader.Close()
+
+		buf := new(bytes.Buffer)
+		if _, err := io.Copy(buf, reader); err != nil {
+			t.Fatalf("failed to read object: %v", err)
+		}
+		if buf.String() != content {
+			t.Errorf("content mismatch: got %d bytes, expected %d", buf.Len(), len(content))
+		}
+	})
+
+	t.Run("list and delete", func(t *testing.T) {
+		if err := gcs.Put(ctx, "redis/backup_1.dump", strings.NewReader("redis")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		objects, err := gcs.List(ctx, "postgres/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(objects) != 1 || objects[0].Name != "postgres/backup_1.sql" {
+			t.Fatalf("expected only postgres/backup_1.sql, got %v", objects)
+		}
+
+		if err := gcs.Delete(ctx, "postgres/backup_1.sql"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		objects, err = gcs.List(ctx, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(objects) != 1 || objects[0].Name != "redis/backup_1.dump" {
+			t.Errorf("expected only redis/backup_1.dump, got %v", objects)
+		}
+	})
+}
+
+func TestGCSStorageMissingCredentialsFile(t *testing.T) {
+	_, err := storage.NewGCSStorage(storage.GCSStorageConfig{
+		Bucket:          "backups",
+		CredentialsFile: t.TempDir() + "/missing.json",
+	})
+	if err == nil || !strings.Contains(err.Error(), "credentials file") {
+		t.Errorf("expected an error reading the credentials file, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/lease"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+)
+
+const testLeaseTTL = 300 * time.Millisecond
+
+// runElector runs e until the returned cancel is called and reports
+// leadership changes on the returned channel.
+func runElector(e *lease.Elector) (<-chan bool, context.CancelFunc) {
+	changes := make(chan bool, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx, func(leading bool, _ uint64) { changes <- leading })
+	}()
+	return changes, func() {
+		cancel()
+		<-done
+	}
+}
+
+func waitLeading(t *testing.T, changes <-chan bool, want bool) {
+	t.Helper()
+	select {
+	case got := <-changes:
+		if got != want {
+			t.Fatalf("expected leading=%v, got %v", want, got)
+		}
+	case <-time.After(5 * testLeaseTTL):
+		t.Fatalf("timed out waiting for leading=%v", want)
+	}
+}
+
+func TestLeaseSingleLeaderAndRelease(t *testing.T) {
+	local := storage.NewLocalStorage(storage.LocalStorageConfig{RootPath: t.TempDir()})
+	a := lease.New(&local, "", "a", testLeaseTTL)
+	b := lease.New(&local, "", "b", testLeaseTTL)
+
+	aChanges, stopA := runElector(a)
+	waitLeading(t, aChanges, true)
+
+	bChanges, stopB := runElector(b)
+	defer stopB()
+	time.Sleep(testLeaseTTL)
+	if leading, _ := b.Leading(); leading {
+		t.Fatalf("expected b to stand by while a holds the lease")
+	}
+	if st := b.Status(); st.Leader != "a" || st.Token != 1 {
+		t.Errorf("unexpected status of b: %+v", st)
+	}
+
+	token, err := a.Check(context.Background())
+	if err != nil || token != 1 {
+		t.Fatalf("Check() = %d, %v", token, err)
+	}
+
+	stopA()
+	if err := a.Release(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A released lease is taken over without waiting for it to expire.
+	waitLeading(t, bChanges, true)
+	if _, token := b.Leading(); token != 2 {
+		t.Errorf("expected the new leader to get token 2, got %d", token)
+	}
+	if _, err := a.Check(context.Background()); !errors.Is(err, lease.ErrNotLeader) {
+		t.Errorf("expected the old leader to be fenced off, got %v", err)
+	}
+}
+
+func TestLeaseExpiresWithoutRenewal(t *testing.T) {
+	local := storage.NewLocalStorage(storage.LocalStorageConfig{RootPath: t.TempDir()})
+	a := lease.New(&local, "leader.lease", "a", testLeaseTTL)
+	b := lease.New(&local, "leader.lease", "b", testLeaseTTL)
+
+	aChanges, stopA := runElector(a)
+	waitLeading(t, aChanges, true)
+	// a stops renewing, as if it crashed.
+	stopA()
+
+	start := time.Now()
+	bChanges, stopB := runElector(b)
+	defer stopB()
+	waitLeading(t, bChanges, true)
+	if time.Since(start) > 2*testLeaseTTL {
+		t.Errorf("takeover took %v", time.Since(start))
+	}
+	if _, token := b.Leading(); token != 2 {
+		t.Errorf("expected token 2, got %d", token)
+	}
+}
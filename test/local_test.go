@@ -36,6 +36,60 @@ func TestLocalStorage_Put(t *testing.T) {
 			t.Errorf("expected context.Canceled error, got %v", err)
 		}
 	})
+
+	t.Run("cancelled mid upload removes partial file", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		pr, pw := io.Pipe()
+		go func() {
+			pw.Write([]byte("partial"))
+			cancel()
+			pw.Write([]byte("more"))
+			pw.Close()
+		}()
+
+		err := storage.Put(ctx, "partial.tar.gz", pr)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled error, got %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(tempDir, "partial.tar.gz")); !os.IsNotExist(err) {
+			t.Errorf("expected partial file to be removed, got %v", err)
+		}
+	})
+
+	t.Run("overwrite is never seen half written", func(t *testing.T) {
+		if err := storage.Put(context.Background(), "lease", strings.NewReader("old")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		pr, pw := io.Pipe()
+		done := make(chan error)
+		go func() { done <- storage.Put(context.Background(), "lease", pr) }()
+		pw.Write([]byte("ne"))
+
+		data, err := os.ReadFile(filepath.Join(tempDir, "lease"))
+		if err != nil || string(data) != "old" {
+			t.Errorf("expected the old content during the write, got %q, %v", data, err)
+		}
+		objects, err := storage.List(context.Background(), "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, obj := range objects {
+			if strings.Contains(obj.Name, "lease") && obj.Name != "lease" {
+				t.Errorf("unexpected object while writing: %s", obj.Name)
+			}
+		}
+
+		pw.Write([]byte("w"))
+		pw.Close()
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data, _ = os.ReadFile(filepath.Join(tempDir, "lease"))
+		if string(data) != "new" {
+			t.Errorf("expected the new content, got %q", data)
+		}
+	})
 }
 
 func TestLocalStorage_Get(t *testing.T) {
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+)
+
+func TestLoggerTextFields(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.New(logger.INFO)
+	log.SetOutput(&buf)
+
+	session := log.NewSession("[backup] [shop-db] ").With("job", "shop-db", "run_id", "20240101-000000-abcd")
+	session.Debug("hidden")
+	session.Info("Backup of %s done", "shop-db")
+	session.With("storage", "off site").Warn("slow")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	if !strings.HasSuffix(lines[0], "[INFO] [backup] [shop-db] Backup of shop-db done job=shop-db run_id=20240101-000000-abcd") {
+		t.Errorf("unexpected line: %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], `[WARN] [backup] [shop-db] slow job=shop-db run_id=20240101-000000-abcd storage="off site"`) {
+		t.Errorf("unexpected line: %q", lines[1])
+	}
+}
+
+func TestLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.New(logger.DEBUG)
+	log.SetOutput(&buf)
+	log.SetFormat(logger.JSON)
+
+	log.NewSession("[backup] [shop-db] ").With("job", "shop-db", "attempt", 2).Error("failed: %v", "timeout")
+
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("output is not JSON: %v: %q", err, buf.String())
+	}
+	if line["level"] != "ERROR" || line["msg"] != "failed: timeout" || line["job"] != "shop-db" || line["attempt"] != float64(2) || line["prefix"] != "[backup] [shop-db]" {
+		t.Errorf("unexpected line: %v", line)
+	}
+}
+
+func TestLoggerSlogInterop(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.New(logger.WARN)
+	log.SetOutput(&buf)
+
+	s := log.Slog().With("component", "s3").WithGroup("req")
+	s.Info("ignored")
+	s.Warn("retrying", "attempt", 3)
+
+	out := strings.TrimSpace(buf.String())
+	if strings.Contains(out, "ignored") || !strings.HasSuffix(out, "[WARN] retrying component=s3 req.attempt=3") {
+		t.Errorf("unexpected output: %q", out)
+	}
+	if !log.Handler().Enabled(context.Background(), slog.LevelError) || log.Handler().Enabled(context.Background(), slog.LevelInfo) {
+		t.Errorf("expected the handler to follow the logger's level")
+	}
+}
+
+func TestLoggerParse(t *testing.T) {
+	for s, want := range map[string]logger.Level{"debug": logger.DEBUG, "INFO": logger.INFO, "warning": logger.WARN, "error": logger.ERROR} {
+		if got, err := logger.ParseLevel(s); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := logger.ParseLevel("verbose"); err == nil {
+		t.Errorf("expected an error for an unknown level")
+	}
+	if f, err := logger.ParseFormat("JSON"); err != nil || f != logger.JSON {
+		t.Errorf("ParseFormat(JSON) = %v, %v", f, err)
+	}
+	if _, err := logger.ParseFormat("xml"); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+
+	t.Setenv("LOG_LEVEL", "loud")
+	if _, err := logger.FromEnv(logger.INFO); err == nil {
+		t.Errorf("expected FromEnv to reject an invalid LOG_LEVEL")
+	}
+}
@@ -0,0 +1,192 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/manager"
+	"github.com/bytekai/docker-auto-backup/internal/scheduler"
+)
+
+type fakeScheduler struct {
+	stopped   bool
+	cancelled bool
+}
+
+func (s *fakeScheduler) Start() error { return nil }
+
+func (s *fakeScheduler) Next() time.Time { return time.Time{} }
+
+func (s *fakeScheduler) Stats() scheduler.Stats { return scheduler.Stats{} }
+
+func (s *fakeScheduler) Cancel() { s.cancelled = true }
+
+func (s *fakeScheduler) Stop() context.Context {
+	s.stopped = true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestManagerKeepsJobAcrossRecreation(t *testing.T) {
+	m := manager.New(logger.New(logger.ERROR))
+
+	old := &fakeScheduler{}
+	m.AddScheduler("shop-db", manager.Job{ContainerID: "old-id"}, old)
+
+	recreated := &fakeScheduler{}
+	m.AddScheduler("shop-db", manager.Job{ContainerID: "new-id"}, recreated)
+	if !old.stopped || !old.cancelled {
+		t.Errorf("expected the replaced scheduler to be stopped and its run cancelled")
+	}
+
+	// The old container dying after its replacement started must not
+	// remove the job.
+	if m.RemoveScheduler("shop-db", "old-id") {
+		t.Errorf("expected removal by a stale container ID to be ignored")
+	}
+	if recreated.stopped {
+		t.Errorf("expected the current scheduler to keep running")
+	}
+	if id, ok := m.ContainerID("shop-db"); !ok || id != "new-id" {
+		t.Errorf("ContainerID() = %q, %v", id, ok)
+	}
+
+	if !m.RemoveScheduler("shop-db", "new-id") {
+		t.Errorf("expected the job to be removed")
+	}
+	if !recreated.stopped {
+		t.Errorf("expected the removed scheduler to be stopped")
+	}
+	if _, ok := m.ContainerID("shop-db"); ok {
+		t.Errorf("expected the job to be gone")
+	}
+}
+
+func TestManagerStopAllWaitsForRuns(t *testing.T) {
+	m := manager.New(logger.New(logger.ERROR))
+
+	release := make(chan struct{})
+	sch, err := scheduler.New(
+		scheduler.Config{Frequency: scheduler.Daily, Time: "02:00", TimeZone: time.UTC},
+		func(ctx context.Context) error {
+			<-release
+			return nil
+		},
+		scheduler.WithClock(dueClock{}),
+		scheduler.WithLogger(logger.New(logger.ERROR)),
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.AddScheduler("db", manager.Job{ContainerID: "id"}, sch); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Let the task start.
+	deadline := time.Now().Add(time.Second)
+	for sch.Stats().Started == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("task never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	drained := m.StopAll()
+	select {
+	case <-drained.Done():
+		t.Fatalf("expected StopAll to wait for the running task")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-drained.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("StopAll did not finish after the task returned")
+	}
+	if _, ok := m.ContainerID("db"); ok {
+		t.Errorf("expected jobs to be removed")
+	}
+}
+
+func TestManagerReplacingWaitsForRun(t *testing.T) {
+	m := manager.New(logger.New(logger.ERROR))
+
+	newScheduler := func(task func(ctx context.Context) error) scheduler.Scheduler {
+		sch, err := scheduler.New(
+			scheduler.Config{Frequency: scheduler.Daily, Time: "02:00", TimeZone: time.UTC},
+			task,
+			scheduler.WithClock(dueClock{}),
+			scheduler.WithLogger(logger.New(logger.ERROR)),
+		)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return sch
+	}
+
+	oldDone := make(chan struct{})
+	old := newScheduler(func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		close(oldDone)
+		return ctx.Err()
+	})
+	if err := m.AddScheduler("db", manager.Job{ContainerID: "old-id"}, old); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for old.Stats().Started == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("task never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	overlapped := make(chan bool, 1)
+	recreated := newScheduler(func(ctx context.Context) error {
+		select {
+		case <-oldDone:
+			overlapped <- false
+		default:
+			overlapped <- true
+		}
+		<-ctx.Done()
+		return nil
+	})
+	if err := m.AddScheduler("db", manager.Job{ContainerID: "new-id"}, recreated); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case o := <-overlapped:
+		if o {
+			t.Errorf("expected the replaced run to finish before the new one started")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("new scheduler never ran")
+	}
+	recreated.Stop()
+	recreated.Cancel()
+}
+
+func TestManagerJobs(t *testing.T) {
+	m := manager.New(logger.New(logger.ERROR))
+	m.AddScheduler("shop-db", manager.Job{ContainerID: "db-id", Hash: "a"}, &fakeScheduler{})
+	m.AddScheduler("wiki", manager.Job{ContainerID: "wiki-id", Hash: "b"}, &fakeScheduler{})
+	m.AddScheduler("wiki", manager.Job{ContainerID: "wiki-new", Hash: "c"}, &fakeScheduler{})
+
+	jobs := m.Jobs()
+	if len(jobs) != 2 || jobs["shop-db"].ContainerID != "db-id" || jobs["wiki"] != (manager.Job{ContainerID: "wiki-new", Hash: "c"}) {
+		t.Errorf("Jobs() = %v", jobs)
+	}
+
+	// The returned map is a copy.
+	delete(jobs, "wiki")
+	if _, ok := m.ContainerID("wiki"); !ok {
+		t.Errorf("expected modifying Jobs() not to affect the manager")
+	}
+}
@@ -0,0 +1,187 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bytekai/docker-auto-backup/internal/models"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+)
+
+type failingStorage struct {
+	models.Storage
+	afterBytes int
+}
+
+func (f *failingStorage) Put(ctx context.Context, name string, file io.Reader) error {
+	if _, err := io.CopyN(io.Discard, file, int64(f.afterBytes)); err != nil {
+		return err
+	}
+	return errors.New("connection reset")
+}
+
+func TestMultiStorage_Put(t *testing.T) {
+	content := strings.Repeat("backup data ", 100*1024)
+
+	newTargets := func(t *testing.T) (map[string]models.Storage, string, string) {
+		localDir, offsiteDir := t.TempDir(), t.TempDir()
+		local := storage.NewLocalStorage(storage.LocalStorageConfig{RootPath: localDir})
+		offsite := storage.NewLocalStorage(storage.LocalStorageConfig{RootPath: offsiteDir})
+		return map[string]models.Storage{
+			"local":   &local,
+			"offsite": &offsite,
+		}, localDir, offsiteDir
+	}
+
+	t.Run("replicates to every destination", func(t *testing.T) {
+		targets, localDir, offsiteDir := newTargets(t)
+		multi := storage.NewMultiStorage(storage.PolicyAll, targets)
+
+		if err := multi.Put(context.Background(), "backup.sql", strings.NewReader(content)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		for _, dir := range []string{localDir, offsiteDir} {
+			data, err := os.ReadFile(filepath.Join(dir, "backup.sql"))
+			if err != nil {
+				t.Fatalf("backup missing in %s: %v", dir, err)
+			}
+			if string(data) != content {
+				t.Errorf("content mismatch in %s: got %d bytes", dir, len(data))
+			}
+		}
+
+		for _, result := range multi.Results() {
+			if result.Err != nil || result.Bytes != int64(len(content)) {
+				t.Errorf("unexpected result for %s: %+v", result.Destination, result)
+			}
+		}
+	})
+
+	t.Run("partial failure with policy all", func(t *testing.T) {
+		targets, _, _ := newTargets(t)
+		targets["broken"] = &failingStorage{afterBytes: 1024}
+		multi := storage.NewMultiStorage(storage.PolicyAll, targets)
+
+		err := multi.Put(context.Background(), "backup.sql", strings.NewReader(content))
+		if err == nil || !strings.Contains(err.Error(), "broken") {
+			t.Fatalf("expected error naming the broken destination, got %v", err)
+		}
+	})
+
+	t.Run("partial failure with policy any", func(t *testing.T) {
+		targets, localDir, _ := newTargets(t)
+		targets["broken"] = &failingStorage{afterBytes: 1024}
+		multi := storage.NewMultiStorage(storage.PolicyAny, targets)
+
+		if err := multi.Put(context.Background(), "backup.sql", strings.NewReader(content)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(localDir, "backup.sql"))
+		if err != nil || string(data) != content {
+			t.Errorf("healthy destination did not receive the full backup: %v", err)
+		}
+
+		failed := 0
+		for _, result := range multi.Results() {
+			if result.Err != nil {
+				failed++
+				if result.Destination != "broken" {
+					t.Errorf("unexpected failure for %s: %v", result.Destination, result.Err)
+				}
+			}
+		}
+		if failed != 1 {
+			t.Errorf("expected exactly one failed destination, got %d", failed)
+		}
+	})
+
+	t.Run("all destinations failing", func(t *testing.T) {
+		multi := storage.NewMultiStorage(storage.PolicyAny, map[string]models.Storage{
+			"a": &failingStorage{afterBytes: 10},
+			"b": &failingStorage{afterBytes: 20},
+		})
+
+		if err := multi.Put(context.Background(), "backup.sql", strings.NewReader(content)); err == nil {
+			t.Fatal("expected error, got nil")
+		}
+	})
+}
+
+func TestMultiStorage_DeleteFailed(t *testing.T) {
+	content := strings.Repeat("backup data ", 100*1024)
+	dir := t.TempDir()
+	local := storage.NewLocalStorage(storage.LocalStorageConfig{RootPath: dir})
+	broken := &deletingStorage{failingStorage: failingStorage{afterBytes: 1024}}
+	multi := storage.NewMultiStorage(storage.PolicyAll, map[string]models.Storage{
+		"local":  &local,
+		"broken": broken,
+	})
+
+	if err := multi.Put(context.Background(), "backup.sql", strings.NewReader(content)); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	failed, err := multi.DeleteFailed(context.Background(), "backup.sql")
+	if !failed || err != nil {
+		t.Fatalf("DeleteFailed() = %v, %v", failed, err)
+	}
+	if len(broken.deleted) != 1 || broken.deleted[0] != "backup.sql" {
+		t.Errorf("expected the failed destination to be cleaned up, got %v", broken.deleted)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backup.sql")); err != nil {
+		t.Errorf("complete copy was removed: %v", err)
+	}
+}
+
+func TestMultiStorage_Succeeded(t *testing.T) {
+	content := strings.Repeat("backup data ", 100*1024)
+	dir := t.TempDir()
+	local := storage.NewLocalStorage(storage.LocalStorageConfig{RootPath: dir})
+	broken := &deletingStorage{failingStorage: failingStorage{afterBytes: 1024}}
+	multi := storage.NewMultiStorage(storage.PolicyAny, map[string]models.Storage{
+		"local":  &local,
+		"broken": broken,
+	})
+
+	if err := multi.Put(context.Background(), "backup.sql", strings.NewReader(content)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The policy tolerates the failure, but the broken copy is still partial.
+	failed, err := multi.DeleteFailed(context.Background(), "backup.sql")
+	if !failed || err != nil {
+		t.Fatalf("DeleteFailed() = %v, %v", failed, err)
+	}
+	if len(broken.deleted) != 1 {
+		t.Errorf("expected the failed destination to be cleaned up, got %v", broken.deleted)
+	}
+
+	succeeded := multi.Succeeded()
+	if err := succeeded.Put(context.Background(), "backup.sql.manifest.json", strings.NewReader("{}")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results := succeeded.Results()
+	if len(results) != 1 || results[0].Destination != "local" {
+		t.Errorf("expected only the healthy destination, got %+v", results)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backup.sql.manifest.json")); err != nil {
+		t.Errorf("manifest missing from healthy destination: %v", err)
+	}
+}
+
+type deletingStorage struct {
+	failingStorage
+	deleted []string
+}
+
+func (d *deletingStorage) Delete(ctx context.Context, name string) error {
+	d.deleted = append(d.deleted, name)
+	return nil
+}
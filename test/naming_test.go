@@ -0,0 +1,83 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/naming"
+)
+
+func TestNamerName(t *testing.T) {
+	vars := naming.Vars{
+		Job:      "shop-db",
+		Name:     "shop-db-1",
+		Project:  "shop",
+		Service:  "db",
+		Provider: "postgres",
+		Hostname: "node1",
+	}
+	at := time.Date(2025, time.March, 4, 5, 6, 7, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{"default", "", "shop-db/backup_20250304_050607.sql"},
+		{"compose layout", `{{.Project}}/{{.Service}}/{{.Time.Format "2006/01/02"}}/{{.Name}}-{{.Timestamp}}.{{.Ext}}`, "shop/db/2025/03/04/shop-db-1-20250304_050607.sql"},
+		{"host and provider", `{{.Hostname}}/{{.Provider}}/{{.Job}}.{{.Ext}}`, "node1/postgres/shop-db.sql"},
+		{"leading slash and dot segments", `/{{.Job}}/../../{{.Job}}.{{.Ext}}`, "shop-db.sql"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := naming.New(tt.template, vars, time.UTC)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := n.Name(at, "sql")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Name() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNamerPrefix(t *testing.T) {
+	vars := naming.Vars{Job: "shop-db", Project: "shop", Service: "db"}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"", "shop-db/"},
+		{`{{.Project}}/{{.Service}}/{{.Time.Format "2006/01/02"}}/{{.Timestamp}}.{{.Ext}}`, "shop/db/"},
+		{`{{.Job}}-{{.Timestamp}}.{{.Ext}}`, ""},
+	}
+
+	for _, tt := range tests {
+		n, err := naming.New(tt.template, vars, time.UTC)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %v", tt.template, err)
+		}
+		if got := n.Prefix("sql"); got != tt.want {
+			t.Errorf("Prefix() for %q = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsInvalidTemplates(t *testing.T) {
+	for _, tmpl := range []string{
+		`{{.Job`,
+		`{{.Unknown}}/{{.Ext}}`,
+		`{{.Job}}/`,
+		`   `,
+	} {
+		if _, err := naming.Parse(tmpl); err == nil {
+			t.Errorf("expected error for %q", tmpl)
+		}
+	}
+}
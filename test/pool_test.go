@@ -0,0 +1,163 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/pool"
+)
+
+func TestPoolLimitsConcurrency(t *testing.T) {
+	p := pool.New(2, 0)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, _, err := p.Acquire(ctx, pool.Request{Job: "job"})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent runs, got %d", peak)
+	}
+	if stats := p.Stats(); stats.Started != 6 || stats.Running != 0 || stats.Queued != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestPoolOrdersByPriorityThenFIFO(t *testing.T) {
+	p := pool.New(1, 0)
+	ctx := context.Background()
+
+	release, _, err := p.Acquire(ctx, pool.Request{Job: "blocker"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	order := make(chan string, 3)
+	queue := func(job string, priority int) {
+		go func() {
+			release, _, err := p.Acquire(ctx, pool.Request{Job: job, Priority: priority})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			order <- job
+			release()
+		}()
+		waitQueued(t, p)
+	}
+	queue("low-1", 0)
+	queue("low-2", 0)
+	queue("high", 10)
+
+	release()
+
+	for _, want := range []string{"high", "low-1", "low-2"} {
+		if got := <-order; got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	}
+}
+
+func TestPoolPerDestinationLimit(t *testing.T) {
+	p := pool.New(0, 1)
+	ctx := context.Background()
+
+	release, _, err := p.Acquire(ctx, pool.Request{Job: "a", Destinations: []string{"offsite"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A run writing elsewhere isn't held up by the busy destination.
+	other, _, err := p.Acquire(ctx, pool.Request{Job: "b", Destinations: []string{"local"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	other()
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := p.Acquire(timeout, pool.Request{Job: "c", Destinations: []string{"offsite"}}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the busy destination to block, got %v", err)
+	}
+	if stats := p.Stats(); stats.Queued != 0 {
+		t.Errorf("expected the abandoned run to leave the queue, got %+v", stats)
+	}
+
+	release()
+	again, waited, err := p.Acquire(ctx, pool.Request{Job: "c", Destinations: []string{"offsite"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if waited > time.Second {
+		t.Errorf("expected no wait once released, waited %v", waited)
+	}
+	again()
+}
+
+func waitQueued(t *testing.T, p *pool.Pool) {
+	t.Helper()
+	want := p.Stats().Queued + 1
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Queued < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("run was never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p := pool.New(1, 0)
+	ctx := context.Background()
+
+	release, _, err := p.Acquire(ctx, pool.Request{Job: "running"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, _, err := p.Acquire(ctx, pool.Request{Job: "waiting"})
+		errs <- err
+	}()
+	waitQueued(t, p)
+
+	p.Close()
+	if err := <-errs; !errors.Is(err, pool.ErrClosed) {
+		t.Errorf("expected waiting run to be rejected, got %v", err)
+	}
+	if _, _, err := p.Acquire(ctx, pool.Request{Job: "late"}); !errors.Is(err, pool.ErrClosed) {
+		t.Errorf("expected new run to be rejected, got %v", err)
+	}
+
+	release()
+	if stats := p.Stats(); stats.Running != 0 {
+		t.Errorf("expected the running run to release its slot, got %+v", stats)
+	}
+}
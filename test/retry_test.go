@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/retry"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	p := retry.Policy{Attempts: 6, Backoff: time.Minute, MaxDelay: 5 * time.Minute}
+	want := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"generic", errors.New("connection reset"), true},
+		{"permanent", fmt.Errorf("backup: %w", retry.Permanent(errors.New("pg_dumpall: not found"))), false},
+		{"cancelled", fmt.Errorf("backup: %w", context.Canceled), false},
+		{"timeout", fmt.Errorf("backup: %w", context.DeadlineExceeded), true},
+		{"server error", &storage.StatusError{Code: 503, Err: errors.New("unavailable")}, true},
+		{"throttled", &storage.StatusError{Code: 429, Err: errors.New("slow down")}, true},
+		{"forbidden", fmt.Errorf("offsite: %w", &storage.StatusError{Code: 403, Err: errors.New("denied")}), false},
+		{"joined", errors.Join(errors.New("local ok"), &storage.StatusError{Code: 401, Err: errors.New("unauthorized")}), false},
+	}
+	for _, tt := range tests {
+		if got := retry.IsRetryable(tt.err); got != tt.want {
+			t.Errorf("%s: IsRetryable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDo(t *testing.T) {
+	p := retry.Policy{Attempts: 3, Backoff: time.Millisecond}
+
+	t.Run("retries until success", func(t *testing.T) {
+		calls, retries := 0, 0
+		err := retry.Do(context.Background(), p, func(ctx context.Context) error {
+			calls++
+			attempt, attempts := retry.Attempt(ctx)
+			if attempt != calls || attempts != 3 {
+				t.Errorf("Attempt() = %d of %d on call %d", attempt, attempts, calls)
+			}
+			if calls < 3 {
+				err := errors.New("transient")
+				if retry.Final(ctx, err) {
+					t.Errorf("attempt %d reported as final", calls)
+				}
+				return err
+			}
+			return nil
+		}, func(int, time.Duration, error) { retries++ })
+		if err != nil || calls != 3 || retries != 2 {
+			t.Errorf("err = %v, calls = %d, retries = %d", err, calls, retries)
+		}
+	})
+
+	t.Run("stops on permanent error", func(t *testing.T) {
+		calls := 0
+		err := retry.Do(context.Background(), p, func(ctx context.Context) error {
+			calls++
+			err := retry.Permanent(errors.New("bad credentials"))
+			if !retry.Final(ctx, err) {
+				t.Errorf("permanent error not reported as final")
+			}
+			return err
+		}, nil)
+		if err == nil || calls != 1 {
+			t.Errorf("err = %v, calls = %d", err, calls)
+		}
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		calls := 0
+		err := retry.Do(context.Background(), p, func(ctx context.Context) error {
+			calls++
+			return errors.New("still down")
+		}, nil)
+		if err == nil || calls != 3 {
+			t.Errorf("err = %v, calls = %d", err, calls)
+		}
+	})
+
+	t.Run("cancellation stops waiting", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		slow := retry.Policy{Attempts: 3, Backoff: time.Hour}
+		calls := 0
+		err := retry.Do(ctx, slow, func(ctx context.Context) error {
+			calls++
+			return errors.New("down")
+		}, func(int, time.Duration, error) { cancel() })
+		if err == nil || calls != 1 {
+			t.Errorf("err = %v, calls = %d", err, calls)
+		}
+	})
+}
+
+func TestDoUntil(t *testing.T) {
+	slow := retry.Policy{Attempts: 3, Backoff: time.Hour}
+
+	t.Run("stop ends the wait", func(t *testing.T) {
+		stop := make(chan struct{})
+		calls := 0
+		err := retry.DoUntil(context.Background(), stop, slow, func(ctx context.Context) error {
+			calls++
+			return errors.New("down")
+		}, func(int, time.Duration, error) { close(stop) })
+		if err == nil || calls != 1 {
+			t.Errorf("err = %v, calls = %d", err, calls)
+		}
+	})
+
+	t.Run("stop leaves the running attempt alone", func(t *testing.T) {
+		stop := make(chan struct{})
+		calls := 0
+		err := retry.DoUntil(context.Background(), stop, slow, func(ctx context.Context) error {
+			calls++
+			close(stop)
+			time.Sleep(10 * time.Millisecond)
+			if ctx.Err() != nil {
+				t.Errorf("attempt cancelled by stop: %v", ctx.Err())
+			}
+			return errors.New("down")
+		}, func(int, time.Duration, error) { t.Errorf("retry scheduled after stop") })
+		if err == nil || calls != 1 {
+			t.Errorf("err = %v, calls = %d", err, calls)
+		}
+	})
+}
@@ -1 +1,319 @@
 package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/retry"
+	"github.com/bytekai/docker-auto-backup/internal/scheduler"
+)
+
+func TestNextRuns(t *testing.T) {
+	from := time.Date(2025, time.January, 30, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		config scheduler.Config
+		want   []time.Time
+	}{
+		{
+			name:   "daily",
+			config: scheduler.Config{Frequency: scheduler.Daily, Time: "02:30", TimeZone: time.UTC},
+			want: []time.Time{
+				time.Date(2025, time.January, 31, 2, 30, 0, 0, time.UTC),
+				time.Date(2025, time.February, 1, 2, 30, 0, 0, time.UTC),
+				time.Date(2025, time.February, 2, 2, 30, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "weekly on sunday",
+			config: scheduler.Config{Frequency: scheduler.Weekly, Time: "00:00", DayOfWeek: 0, TimeZone: time.UTC},
+			want: []time.Time{
+				time.Date(2025, time.February, 2, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, time.February, 9, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, time.February, 16, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:   "monthly skips short months",
+			config: scheduler.Config{Frequency: scheduler.Monthly, Time: "00:00", DayOfMonth: 31, TimeZone: time.UTC},
+			want: []time.Time{
+				time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, time.March, 31, 0, 0, 0, 0, time.UTC),
+				time.Date(2025, time.May, 31, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := scheduler.NextRuns(tt.config, from, len(tt.want))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i := range tt.want {
+				if !got[i].Equal(tt.want[i]) {
+					t.Errorf("run %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNextRuns_InvalidConfig(t *testing.T) {
+	_, err := scheduler.NextRuns(scheduler.Config{Frequency: scheduler.Weekly, Time: "00:00", DayOfWeek: 9}, time.Now(), 5)
+	if err == nil {
+		t.Errorf("expected error for invalid day of week")
+	}
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestSchedulerSpread(t *testing.T) {
+	clk := &fakeClock{now: time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	config := scheduler.Config{Frequency: scheduler.Daily, Time: "00:00", TimeZone: time.UTC, Spread: time.Hour}
+	base := time.Date(2025, time.March, 2, 0, 0, 0, 0, time.UTC)
+
+	next := func(job string) time.Time {
+		sch, err := scheduler.New(config, func(context.Context) error { return nil }, scheduler.WithClock(clk), scheduler.WithJob(job))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return sch.Next()
+	}
+
+	offsets := make(map[time.Duration]bool)
+	for _, job := range []string{"shop-db", "shop-cache", "wiki-db", "git-db"} {
+		got := next(job)
+		offset := got.Sub(base)
+		if offset < 0 || offset >= time.Hour {
+			t.Errorf("%s: next run %v is outside the spread window", job, got)
+		}
+		if again := next(job); !again.Equal(got) {
+			t.Errorf("%s: expected a stable offset, got %v and %v", job, got, again)
+		}
+		offsets[offset] = true
+	}
+	if len(offsets) < 2 {
+		t.Errorf("expected jobs to be spread over the window, got offsets %v", offsets)
+	}
+
+	// A run whose base time passed but whose offset hasn't is still due today.
+	sch, err := scheduler.New(config, func(context.Context) error { return nil }, scheduler.WithClock(clk), scheduler.WithJob("shop-db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	clk.now = base.Add(-24 * time.Hour)
+	today := sch.Next()
+	if today.Before(clk.now) || today.Sub(clk.now) >= time.Hour {
+		t.Fatalf("expected a run within the hour, got %v", today)
+	}
+	clk.now = today.Add(-time.Second)
+	if got := sch.Next(); !got.Equal(today) {
+		t.Errorf("expected pending run %v, got %v", today, got)
+	}
+	clk.now = today.Add(time.Second)
+	if got := sch.Next(); !got.Equal(today.Add(24 * time.Hour)) {
+		t.Errorf("expected the next day's run after %v, got %v", today, got)
+	}
+}
+
+func TestSchedulerJitter(t *testing.T) {
+	from := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	config := scheduler.Config{Frequency: scheduler.Daily, Time: "02:00", TimeZone: time.UTC, Jitter: 15 * time.Minute}
+
+	runs, err := scheduler.NextRuns(config, from, 10, scheduler.WithJob("shop-db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	again, err := scheduler.NextRuns(config, from, 10, scheduler.WithJob("shop-db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	offsets := make(map[time.Duration]bool)
+	for i, run := range runs {
+		base := time.Date(2025, time.March, 2+i, 2, 0, 0, 0, time.UTC)
+		offset := run.Sub(base)
+		if offset < 0 || offset >= 15*time.Minute {
+			t.Errorf("run %d at %v is outside the jitter window", i, run)
+		}
+		if !again[i].Equal(run) {
+			t.Errorf("run %d is not reproducible: %v vs %v", i, run, again[i])
+		}
+		offsets[offset] = true
+	}
+	if len(offsets) < 2 {
+		t.Errorf("expected jitter to vary between runs, got %v", offsets)
+	}
+}
+
+func TestSchedulerRejectsNegativeSpread(t *testing.T) {
+	config := scheduler.Config{Frequency: scheduler.Daily, Time: "02:00", Spread: -time.Minute}
+	if _, err := scheduler.New(config, func(context.Context) error { return nil }); err == nil {
+		t.Errorf("expected error for negative spread")
+	}
+}
+
+func TestSchedulerRejectsOffsetsBeyondPeriod(t *testing.T) {
+	task := func(context.Context) error { return nil }
+
+	config := scheduler.Config{Frequency: scheduler.Daily, Time: "02:00", Spread: 20 * time.Hour, Jitter: 4 * time.Hour}
+	if _, err := scheduler.New(config, task); err == nil {
+		t.Errorf("expected error for spread and jitter spanning a day")
+	}
+
+	config.Frequency = scheduler.Weekly
+	if _, err := scheduler.New(config, task); err != nil {
+		t.Errorf("unexpected error for weekly backups: %v", err)
+	}
+}
+
+// dueClock always reports a time just before the next run, so the scheduler
+// fires every millisecond.
+type dueClock struct{}
+
+func (dueClock) Now() time.Time {
+	return time.Date(2025, time.March, 1, 1, 59, 59, 999000000, time.UTC)
+}
+
+func TestSchedulerOverlapPolicies(t *testing.T) {
+	config := scheduler.Config{Frequency: scheduler.Daily, Time: "02:00", TimeZone: time.UTC}
+
+	run := func(t *testing.T, policy scheduler.OverlapPolicy, task func(ctx context.Context)) scheduler.Stats {
+		t.Helper()
+		config.Overlap = policy
+		sch, err := scheduler.New(config, func(ctx context.Context) error {
+			task(ctx)
+			return nil
+		}, scheduler.WithClock(dueClock{}))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := sch.Start(); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		<-sch.Stop().Done()
+		return sch.Stats()
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		release := make(chan struct{})
+		time.AfterFunc(30*time.Millisecond, func() { close(release) })
+		stats := run(t, scheduler.OverlapSkip, func(ctx context.Context) { <-release })
+		if stats.Skipped == 0 || stats.Queued != 0 {
+			t.Errorf("expected overlapping runs to be skipped, got %+v", stats)
+		}
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		release := make(chan struct{})
+		time.AfterFunc(30*time.Millisecond, func() { close(release) })
+		var running, peak int32
+		var mu sync.Mutex
+		stats := run(t, scheduler.OverlapQueue, func(ctx context.Context) {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			running--
+			mu.Unlock()
+		})
+		if stats.Queued == 0 || stats.Started < 2 {
+			t.Errorf("expected a queued run to start after the first, got %+v", stats)
+		}
+		if peak > 1 {
+			t.Errorf("expected runs not to overlap, got %d at once", peak)
+		}
+	})
+
+	t.Run("cancel previous", func(t *testing.T) {
+		var mu sync.Mutex
+		cancelled := 0
+		stats := run(t, scheduler.OverlapCancelPrevious, func(ctx context.Context) {
+			select {
+			case <-ctx.Done():
+				mu.Lock()
+				cancelled++
+				mu.Unlock()
+			case <-time.After(time.Second):
+			}
+		})
+		if stats.Cancelled == 0 || cancelled == 0 {
+			t.Errorf("expected the previous run to be cancelled, got %+v (%d observed)", stats, cancelled)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		config.Overlap = "parallel"
+		if _, err := scheduler.New(config, func(context.Context) error { return nil }); err == nil {
+			t.Errorf("expected error for unknown overlap policy")
+		}
+	})
+}
+
+func TestSchedulerStopEndsPendingRetries(t *testing.T) {
+	config := scheduler.Config{
+		Frequency: scheduler.Daily,
+		Time:      "02:00",
+		TimeZone:  time.UTC,
+		Retry:     retry.Policy{Attempts: 3, Backoff: time.Hour},
+	}
+	failed := make(chan struct{}, 1)
+	sch, err := scheduler.New(config, func(ctx context.Context) error {
+		select {
+		case failed <- struct{}{}:
+		default:
+		}
+		return errors.New("down")
+	}, scheduler.WithClock(dueClock{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sch.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-failed
+
+	select {
+	case <-sch.Stop().Done():
+	case <-time.After(time.Second):
+		t.Fatal("Stop waited for a pending retry")
+	}
+}
+
+func TestSchedulerLogsJob(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.New(logger.INFO)
+	log.SetOutput(&buf)
+
+	config := scheduler.Config{Frequency: scheduler.Daily, Time: "02:00", TimeZone: time.UTC}
+	sch, err := scheduler.New(config, func(context.Context) error { return nil },
+		scheduler.WithLogger(log), scheduler.WithJob("shop-db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := sch.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	<-sch.Stop().Done()
+
+	if !strings.Contains(buf.String(), "Starting scheduler job=shop-db") {
+		t.Errorf("expected the job field on scheduler logs, got %q", buf.String())
+	}
+}
@@ -0,0 +1,91 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bytekai/docker-auto-backup/internal/secret"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+)
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "s3_key")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	t.Setenv("S3_SECRET", "from-env")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain value", value: "plain", want: "plain"},
+		{name: "file reference", value: "file:" + secretFile, want: "from-file"},
+		{name: "env reference", value: "env:S3_SECRET", want: "from-env"},
+		{name: "missing file", value: "file:" + filepath.Join(dir, "missing"), wantErr: true},
+		{name: "unset env", value: "env:DOES_NOT_EXIST_" + t.Name(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := secret.Resolve(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Resolve() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveMap_FileSuffix(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret_key")
+	if err := os.WriteFile(secretFile, []byte("s3cr3t"), 0600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+
+	got, err := secret.ResolveMap(map[string]string{
+		"bucket":          "backups",
+		"secret_key_file": secretFile,
+	}, "secret_key")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got["secret_key"] != "s3cr3t" {
+		t.Errorf("secret_key = %q, want %q", got["secret_key"], "s3cr3t")
+	}
+	if got["bucket"] != "backups" {
+		t.Errorf("bucket = %q, want %q", got["bucket"], "backups")
+	}
+}
+
+func TestString_Redacted(t *testing.T) {
+	config := storage.S3StorageConfig{
+		AccessKey: "AKIA",
+		SecretKey: "very-secret",
+		Bucket:    "backups",
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Contains(string(data), "very-secret") {
+		t.Errorf("secret leaked in JSON: %s", data)
+	}
+	if !strings.Contains(string(data), "[REDACTED]") {
+		t.Errorf("expected redaction marker in JSON: %s", data)
+	}
+	if config.SecretKey.Value() != "very-secret" {
+		t.Errorf("Value() = %q, want %q", config.SecretKey.Value(), "very-secret")
+	}
+}
@@ -0,0 +1,67 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+	"github.com/bytekai/docker-auto-backup/internal/verify"
+)
+
+func TestLatest(t *testing.T) {
+	dir := t.TempDir()
+	local := storage.NewLocalStorage(storage.LocalStorageConfig{RootPath: dir})
+
+	base := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+	files := map[string]time.Time{
+		"db/backup_20250301_000000.sql":             base,
+		"db/backup_20250302_000000.sql":             base.Add(24 * time.Hour),
+		"db/backup_20250302_000000.sql.verify.json": base.Add(25 * time.Hour),
+		"db/backup_20250303_000000.dump":            base.Add(48 * time.Hour),
+		"other/backup_20250304_000000.sql":          base.Add(72 * time.Hour),
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory for %s: %v", name, err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("failed to set mtime of %s: %v", name, err)
+		}
+	}
+
+	got, err := verify.Latest(context.Background(), &local, "db/", "sql")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "db/backup_20250302_000000.sql" {
+		t.Errorf("Latest() = %q, want %q", got, "db/backup_20250302_000000.sql")
+	}
+
+	if _, err := verify.Latest(context.Background(), &local, "db/", "tar"); err == nil {
+		t.Errorf("expected error when no backups match")
+	}
+
+	// Other jobs' backups share the storage root.
+	if _, err := verify.Latest(context.Background(), &local, "", "sql"); err == nil {
+		t.Errorf("expected error without a prefix")
+	}
+}
+
+func TestIsVerification(t *testing.T) {
+	if !verify.IsVerification(map[string]string{verify.Label: "abc", "backup.enabled": "true"}) {
+		t.Error("verification container not recognized")
+	}
+	if verify.IsVerification(map[string]string{"backup.enabled": "true"}) {
+		t.Error("regular container taken for a verification container")
+	}
+	if verify.IsVerification(nil) {
+		t.Error("container without labels taken for a verification container")
+	}
+}
@@ -0,0 +1,319 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+	"golang.org/x/net/webdav"
+)
+
+// newWebDAVServer serves an in-memory WebDAV tree behind basic auth. Requests
+// under /uploads/ emulate Nextcloud's chunked upload endpoint.
+func newWebDAVServer(t *testing.T) (*httptest.Server, webdav.FileSystem) {
+	t.Helper()
+
+	fs := webdav.NewMemFS()
+	dav := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	var mu sync.Mutex
+	chunks := make(map[string]map[string][]byte)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "backup" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="dav"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if !strings.HasPrefix(r.URL.Path, "/uploads/") {
+			dav.ServeHTTP(w, r)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/uploads/"), "/", 2)
+		switch {
+		case r.Method == "MKCOL":
+			chunks[parts[0]] = make(map[string][]byte)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			chunks[parts[0]][parts[1]] = data
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "MOVE" && parts[1] == ".file":
+			names := make([]string, 0, len(chunks[parts[0]]))
+			for name := range chunks[parts[0]] {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			var assembled bytes.Buffer
+			for _, name := range names {
+				assembled.Write(chunks[parts[0]][name])
+			}
+			delete(chunks, parts[0])
+
+			dest := strings.TrimPrefix(r.Header.Get("Destination"), "http://"+r.Host+"/dav")
+			f, err := fs.OpenFile(r.Context(), dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			f.Write(assembled.Bytes())
+			f.Close()
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server, fs
+}
+
+func readAll(t *testing.T, reader io.ReadCloser) string {
+	t.Helper()
+	defer reader.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, reader); err != nil {
+		t.Fatalf("failed to read content: %v", err)
+	}
+	return buf.String()
+}
+
+func TestWebDAVStorage(t *testing.T) {
+	server, _ := newWebDAVServer(t)
+	ctx := context.Background()
+
+	dav, err := storage.NewWebDAVStorage(storage.WebDAVStorageConfig{
+		URL:      server.URL + "/dav",
+		Username: "backup",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	t.Run("put creates collections", func(t *testing.T) {
+		if err := dav.Put(ctx, "project/postgres/backup_1.sql", strings.NewReader("dump 1")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := dav.Put(ctx, "project/postgres/backup_2.sql", strings.NewReader("dump 2")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := dav.Put(ctx, "project/redis/backup_1.dump", strings.NewReader("redis")); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		reader, err := dav.Get(ctx, "project/postgres/backup_2.sql")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := readAll(t, reader); got != "dump 2" {
+			t.Errorf("content mismatch: expected %q, got %q", "dump 2", got)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		objects, err := dav.List(ctx, "project/postgres/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(objects) != 2 {
+			t.Fatalf("expected 2 objects, got %v", objects)
+		}
+
+		objects, err = dav.List(ctx, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(objects) != 3 {
+			t.Errorf("expected 3 objects in total, got %v", objects)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := dav.Delete(ctx, "project/postgres/backup_1.sql"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		objects, err := dav.List(ctx, "project/postgres/")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(objects) != 1 || objects[0].Name != "project/postgres/backup_2.sql" {
+			t.Errorf("expected only backup_2.sql, got %v", objects)
+		}
+	})
+
+	t.Run("wrong credentials", func(t *testing.T) {
+		bad, err := storage.NewWebDAVStorage(storage.WebDAVStorageConfig{
+			URL:      server.URL + "/dav",
+			Username: "backup",
+			Password: "wrong",
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := bad.Put(ctx, "backup.sql", strings.NewReader("dump")); err == nil {
+			t.Errorf("expected error, got nil")
+		}
+	})
+}
+
+func TestWebDAVStorage_ChunkedUpload(t *testing.T) {
+	server, _ := newWebDAVServer(t)
+	ctx := context.Background()
+
+	dav, err := storage.NewWebDAVStorage(storage.WebDAVStorageConfig{
+		URL:        server.URL + "/dav",
+		Username:   "backup",
+		Password:   "secret",
+		Auth:       "basic",
+		ChunkSize:  1024,
+		UploadsURL: server.URL + "/uploads",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	content := strings.Repeat("0123456789", 1000)
+	if err := dav.Put(ctx, "large/backup.sql", strings.NewReader(content)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reader, err := dav.Get(ctx, "large/backup.sql")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, reader); got != content {
+		t.Errorf("content mismatch: got %d bytes, expected %d", len(got), len(content))
+	}
+}
+
+// digestServer serves an in-memory WebDAV tree behind SHA-256 digest auth.
+// Rotating the nonce makes the previous one stale and resets the record of
+// rejected requests.
+type digestServer struct {
+	mu       sync.Mutex
+	nonce    int
+	rejected []string
+}
+
+func (d *digestServer) rotate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nonce++
+	d.rejected = nil
+}
+
+func (d *digestServer) handler(dav http.Handler) http.Handler {
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		nonce := fmt.Sprintf("nonce-%d", d.nonce)
+		d.mu.Unlock()
+
+		params := make(map[string]string)
+		if scheme, rest, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && scheme == "Digest" {
+			for _, part := range strings.Split(rest, ", ") {
+				key, value, _ := strings.Cut(part, "=")
+				params[key] = strings.Trim(value, `"`)
+			}
+		}
+
+		challenge := fmt.Sprintf(`Digest realm="dav", nonce="%s", qop="auth", algorithm=SHA-256`, nonce)
+		if params["nonce"] != "" && params["nonce"] != nonce {
+			challenge += ", stale=true"
+		}
+		ha1 := hash("backup:dav:secret")
+		ha2 := hash(r.Method + ":" + params["uri"])
+		want := hash(strings.Join([]string{ha1, nonce, params["nc"], params["cnonce"], params["qop"], ha2}, ":"))
+		if params["algorithm"] != "SHA-256" || params["nonce"] != nonce || params["response"] != want {
+			io.Copy(io.Discard, r.Body)
+			d.mu.Lock()
+			d.rejected = append(d.rejected, r.Method)
+			d.mu.Unlock()
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		dav.ServeHTTP(w, r)
+	})
+}
+
+func TestWebDAVStorage_DigestStaleNonce(t *testing.T) {
+	digest := &digestServer{}
+	server := httptest.NewServer(digest.handler(&webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	dav, err := storage.NewWebDAVStorage(storage.WebDAVStorageConfig{
+		URL:      server.URL + "/dav",
+		Username: "backup",
+		Password: "secret",
+		Auth:     "digest",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := dav.Put(ctx, "db/backup_1.sql", strings.NewReader("dump 1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A streamed body must not be sent with a stale nonce.
+	digest.rotate()
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("dump 2"))
+		pw.Close()
+	}()
+	if err := dav.Put(ctx, "backup_2.sql", pr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := strings.Join(digest.rejected, ","); got != "HEAD" {
+		t.Errorf("expected only the probe to be rejected, got %s", got)
+	}
+
+	// Requests without a body are simply repeated.
+	digest.rotate()
+	reader, err := dav.Get(ctx, "backup_2.sql")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := readAll(t, reader); got != "dump 2" {
+		t.Errorf("content mismatch: expected %q, got %q", "dump 2", got)
+	}
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/config"
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/naming"
+	"github.com/bytekai/docker-auto-backup/internal/provider"
+	"github.com/bytekai/docker-auto-backup/internal/scheduler"
+	"github.com/bytekai/docker-auto-backup/internal/storage"
+	"github.com/docker/docker/api/types/container"
+	"gopkg.in/yaml.v3"
+)
+
+var knownKeys = []string{
+	"enabled",
+	"name",
+	"frequency",
+	"time",
+	"time_zone",
+	"spread",
+	"jitter",
+	"overlap",
+	"day_of_month",
+	"day_of_week",
+	"day_of_year",
+	"provider",
+	"naming",
+	"priority",
+	"timeout",
+	"retry.attempts",
+	"retry.backoff",
+	"retry.max_delay",
+	"storage",
+	"storage.policy",
+	"notify",
+	"verify.frequency",
+	"verify.time",
+	"verify.time_zone",
+	"verify.spread",
+	"verify.jitter",
+	"verify.overlap",
+	"verify.day_of_month",
+	"verify.day_of_week",
+	"verify.day_of_year",
+	"verify.command",
+	"verify.timeout",
+}
+
+var storageFields = map[string][]string{
+	"local":  {"root_path"},
+	"s3":     {"bucket", "region", "access_key", "secret_key"},
+	"gcs":    {"bucket", "credentials_file", "credentials_json", "endpoint", "chunk_size", "metadata.*"},
+	"azure":  {"account_name", "account_key", "sas_token", "connection_string", "endpoint", "container", "access_tier", "block_size"},
+	"webdav": {"url", "username", "password", "auth", "chunk_size", "uploads_url"},
+}
+
+var providerFields = map[string][]string{
+	"postgres": {"user", "password"},
+}
+
+var notifierFields = []string{"type", "on", "url", "headers.*"}
+
+type target struct {
+	name   string
+	labels map[string]string
+	// job is the name the daemon would give the job.
+	job string
+}
+
+type report struct {
+	errors   []string
+	warnings []string
+	info     []string
+	runs     []time.Time
+}
+
+func (r *report) errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func (r *report) warnf(format string, args ...interface{}) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+func runValidate(args []string) int {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	composeFile := fs.String("compose", "", "validate the services of a compose file instead of running containers")
+	offline := fs.Bool("offline", false, "skip storage reachability checks")
+	runs := fs.Int("runs", 5, "number of upcoming run times to show per job")
+	fs.Parse(args)
+
+	configPath, required := os.LookupEnv("BACKUP_CONFIG")
+	if !required {
+		configPath = config.DefaultPath
+	}
+	global, err := config.Load(configPath, required)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
+		return 1
+	}
+
+	ctx := context.Background()
+
+	var targets []target
+	if *composeFile != "" {
+		targets, err = composeTargets(*composeFile)
+	} else {
+		targets, err = containerTargets(ctx, global)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+
+	log := logger.New(logger.ERROR)
+	log.SetOutput(io.Discard)
+	session := log.NewSession("[validate] ")
+
+	failed, jobs := 0, 0
+	for _, t := range targets {
+		if len(extractLabels(t.labels)) == 0 {
+			continue
+		}
+		jobs++
+		if !validateTarget(ctx, os.Stdout, session, global, t, !*offline, *runs) {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d of %d jobs have errors\n", failed, jobs)
+		return 1
+	}
+	fmt.Printf("\nAll %d jobs are valid\n", jobs)
+	return 0
+}
+
+func validateTarget(ctx context.Context, w io.Writer, session *logger.Session, global *config.Config, t target, checkStorage bool, runs int) bool {
+	labels := extractLabels(t.labels)
+
+	r := &report{}
+	lintLabels(labels, global.Merge(labels), r)
+
+	if t.job != t.name {
+		fmt.Fprintf(w, "%s (job %s):\n", t.name, t.job)
+	} else {
+		fmt.Fprintf(w, "%s:\n", t.name)
+	}
+	defer func() {
+		for _, e := range r.errors {
+			fmt.Fprintf(w, "  error: %s\n", e)
+		}
+		for _, warning := range r.warnings {
+			fmt.Fprintf(w, "  warning: %s\n", warning)
+		}
+		for _, info := range r.info {
+			fmt.Fprintf(w, "  %s\n", info)
+		}
+		if len(r.runs) > 0 {
+			fmt.Fprintf(w, "  next runs:\n")
+			for _, run := range r.runs {
+				fmt.Fprintf(w, "    %s\n", run.Format("Mon 2006-01-02 15:04 MST"))
+			}
+		}
+	}()
+
+	if labels["enabled"] != "true" {
+		r.warnf("backup.enabled is not \"true\", job is disabled")
+		return len(r.errors) == 0
+	}
+
+	cfg, err := parseConfig(global, labels)
+	if err != nil {
+		r.errorf("%v", err)
+		return false
+	}
+
+	if !provider.Supported(cfg.Provider) {
+		r.errorf("provider %s is not supported yet, backups would fail", cfg.Provider)
+	}
+	if _, err := scheduler.New(*cfg, func(context.Context) error { return nil }); err != nil {
+		r.errorf("%v", err)
+		return false
+	}
+	if cfg.Verify != nil {
+		if _, err := scheduler.New(cfg.Verify.Schedule, func(context.Context) error { return nil }); err != nil {
+			r.errorf("invalid verify schedule: %v", err)
+		}
+		// Verification finds the job's latest backup by its prefix.
+		namer, err := naming.New(cfg.Naming, naming.Vars{
+			Job:      t.job,
+			Name:     t.name,
+			Project:  composeProject(t.labels),
+			Service:  t.labels[composeServiceLabel],
+			Provider: cfg.Provider,
+		}, cfg.TimeZone)
+		if err == nil && namer.Prefix("ext") == "" {
+			r.errorf("verify needs a naming template starting with a directory specific to the job, e.g. {{.Job}}/")
+		}
+	}
+
+	for _, dest := range cfg.Destinations {
+		if err := dest.Config.Validate(dest.Type); err != nil {
+			r.errorf("storage %s (%s): %v", dest.Name, dest.Type, err)
+			continue
+		}
+		if !checkStorage {
+			continue
+		}
+		if err := checkDestination(ctx, session, dest); err != nil {
+			r.errorf("storage %s (%s) is unreachable: %v", dest.Name, dest.Type, err)
+			continue
+		}
+		r.info = append(r.info, fmt.Sprintf("storage %s (%s): reachable", dest.Name, dest.Type))
+	}
+
+	r.runs, err = scheduler.NextRuns(*cfg, time.Now(), runs, scheduler.WithJob(t.job))
+	if err != nil {
+		r.errorf("%v", err)
+		return false
+	}
+
+	return len(r.errors) == 0
+}
+
+func checkDestination(ctx context.Context, session *logger.Session, dest storage.Destination) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	s := storage.NewStorage(&provider.ProviderContext{Session: session}, dest.Type, dest.Config)
+	if s == nil {
+		return fmt.Errorf("failed to create storage")
+	}
+
+	_, err := s.List(ctx, "")
+	return err
+}
+
+// lintLabels reports backup.* labels that no part of the tool reads. merged
+// holds the labels combined with the global config so that destinations and
+// notifiers referenced from defaults are taken into account.
+func lintLabels(labels, merged map[string]string, r *report) {
+	destinations := make(map[string]bool)
+	for _, name := range strings.Split(getStringWithDefault(merged, "storage", "local"), ",") {
+		destinations[strings.TrimSpace(name)] = true
+	}
+	notifiers := make(map[string]bool)
+	for _, name := range strings.Split(merged["notify"], ",") {
+		notifiers[strings.TrimSpace(name)] = true
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if contains(knownKeys, key) {
+			continue
+		}
+
+		parts := strings.SplitN(key, ".", 3)
+		if len(parts) == 3 {
+			switch parts[0] {
+			case "storage":
+				if !destinations[parts[1]] {
+					r.warnf("backup.%s configures storage %q which is not listed in backup.storage", key, parts[1])
+					continue
+				}
+				storageType := merged["storage."+parts[1]+".type"]
+				if storageType == "" {
+					storageType = parts[1]
+				}
+				if parts[2] != "type" && !matchField(storageFields[storageType], parts[2]) {
+					r.warnf("unknown label backup.%s for %s storage", key, storageType)
+				}
+				continue
+			case "provider":
+				if parts[1] != merged["provider"] {
+					r.warnf("backup.%s configures provider %q but backup.provider is %q", key, parts[1], merged["provider"])
+					continue
+				}
+				if !matchField(providerFields[parts[1]], parts[2]) {
+					r.warnf("unknown label backup.%s for %s provider", key, parts[1])
+				}
+				continue
+			case "notify":
+				if !notifiers[parts[1]] {
+					r.warnf("backup.%s configures notifier %q which is not listed in backup.notify", key, parts[1])
+					continue
+				}
+				if !matchField(notifierFields, parts[2]) {
+					r.warnf("unknown label backup.%s for notifier %s", key, parts[1])
+				}
+				continue
+			}
+		}
+
+		if suggestion := closest(key, knownKeys); suggestion != "" {
+			r.errorf("unknown label backup.%s (did you mean backup.%s?)", key, suggestion)
+		} else {
+			r.errorf("unknown label backup.%s", key)
+		}
+	}
+}
+
+func matchField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field || f+"_file" == field || f+"_FILE" == field {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(f, "*"); ok && strings.HasPrefix(field, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// closest returns the candidate within two edits of s, if any.
+func closest(s string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := levenshtein(s, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// containerTargets lists the running containers of every configured host,
+// naming their jobs as the daemon does.
+func containerTargets(ctx context.Context, global *config.Config) ([]target, error) {
+	log := logger.New(logger.ERROR)
+	log.SetOutput(io.Discard)
+
+	hostConfigs := global.Hosts
+	if len(hostConfigs) == 0 {
+		hostConfigs = []config.Host{{}}
+	}
+
+	var targets []target
+	for _, cfg := range hostConfigs {
+		h, err := newHost(log, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("host %s: %v", cfg.Name, err)
+		}
+		defer h.cli.Close()
+
+		containers, err := h.cli.ContainerList(ctx, container.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers on %s: %v", h.label(), err)
+		}
+		h.detectEngine(ctx, log.NewSession(""))
+
+		for _, c := range containers {
+			if !h.managed(c) {
+				continue
+			}
+			name := c.ID[:12]
+			if len(c.Names) > 0 {
+				name = strings.TrimPrefix(c.Names[0], "/")
+			}
+			if h.name != "" {
+				name = h.name + "/" + name
+			}
+			j := h.job(c.ID, containerName(c.Names), c.Labels)
+			targets = append(targets, target{name: name, labels: c.Labels, job: j.Name})
+		}
+	}
+	return targets, nil
+}
+
+type composeFile struct {
+	Name     string `yaml:"name"`
+	Services map[string]struct {
+		Labels any `yaml:"labels"`
+	} `yaml:"services"`
+}
+
+func composeTargets(path string) ([]target, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %v", err)
+	}
+
+	var f composeFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse compose file: %v", err)
+	}
+
+	project := composeProjectName(path, f.Name)
+
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	targets := make([]target, 0, len(names))
+	for _, name := range names {
+		labels := make(map[string]string)
+		// Compose accepts labels both as a mapping and as a list of key=value.
+		switch l := f.Services[name].Labels.(type) {
+		case map[string]any:
+			for key, value := range l {
+				labels[key] = fmt.Sprint(value)
+			}
+		case []any:
+			for _, item := range l {
+				key, value, _ := strings.Cut(fmt.Sprint(item), "=")
+				labels[key] = value
+			}
+		}
+		// Compose adds these when it creates the containers.
+		labels[composeProjectLabel] = project
+		labels[composeServiceLabel] = name
+		targets = append(targets, target{name: name, labels: labels, job: jobName(name, labels)})
+	}
+	return targets, nil
+}
+
+// composeProjectName returns the project name Compose uses for the file at
+// path: COMPOSE_PROJECT_NAME, else the file's name, else its directory's
+// name, normalized like Compose does.
+func composeProjectName(path, declared string) string {
+	name := os.Getenv("COMPOSE_PROJECT_NAME")
+	if name == "" {
+		name = declared
+	}
+	if name == "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			name = filepath.Base(filepath.Dir(abs))
+		}
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || (r == '-' || r == '_') && b.Len() > 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
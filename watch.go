@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bytekai/docker-auto-backup/internal/logger"
+	"github.com/bytekai/docker-auto-backup/internal/provider"
+	"github.com/bytekai/docker-auto-backup/internal/scheduler"
+	"github.com/bytekai/docker-auto-backup/internal/verify"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+)
+
+const (
+	minWatchBackoff = time.Second
+	maxWatchBackoff = time.Minute
+)
+
+// watch keeps the jobs of h in sync with its containers until ctx is done. Jobs are
+// reconciled after connecting to the event stream, on every container event
+// and every reconcile interval. Whenever the event stream breaks, e.g.
+// because the Docker daemon restarted, it reconnects with backoff and
+// replays the events missed in between.
+func (d *daemon) watch(ctx, runCtx context.Context, h *host) {
+	session := d.log.NewSession(fmt.Sprintf("[watch] [%s] ", h.label())).With("host", h.label())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.reconcileLoop(ctx, runCtx, session, h)
+	}()
+	// Don't let a reconcile add jobs after the caller shuts down.
+	defer func() { <-done }()
+
+	filterArgs := filters.NewArgs()
+	filterArgs.Add("type", "container")
+	for _, action := range []string{"start", "die", "pause", "unpause", "rename", "destroy"} {
+		filterArgs.Add("event", action)
+	}
+
+	since := time.Now()
+	backoff := minWatchBackoff
+	for ctx.Err() == nil {
+		connected := time.Now()
+		eventsCh, errCh := h.cli.Events(ctx, events.ListOptions{
+			Filters: filterArgs,
+			// Whole seconds are understood by Podman too. Replaying the
+			// last second again only triggers an extra reconcile.
+			Since: strconv.FormatInt(since.Unix(), 10),
+		})
+		// Reconcile after subscribing so nothing happens unnoticed in between.
+		h.requestReconcile()
+
+		err := followEvents(ctx, eventsCh, errCh, &since, h.requestReconcile)
+		if ctx.Err() != nil {
+			return
+		}
+
+		h.setConnected(fmt.Errorf("lost event stream: %v", err))
+		if time.Since(connected) > maxWatchBackoff {
+			backoff = minWatchBackoff
+		}
+		session.Error("Lost connection to Docker events, reconnecting in %v: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxWatchBackoff)
+	}
+}
+
+// followEvents calls reconcile for every event until the stream fails,
+// keeping since at the time of the last event seen so a reconnect can
+// resume from there. Events are only used as a trigger, so engines whose
+// event attributes differ from Docker's, like Podman, work the same.
+// Events of verification containers, which come and go with every
+// verification run, don't trigger a reconcile.
+func followEvents(ctx context.Context, eventsCh <-chan events.Message, errCh <-chan error, since *time.Time, reconcile func()) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errCh:
+			return err
+		case event := <-eventsCh:
+			if event.TimeNano > 0 {
+				*since = time.Unix(0, event.TimeNano)
+			} else {
+				*since = time.Now()
+			}
+			if verify.IsVerification(event.Actor.Attributes) {
+				continue
+			}
+			reconcile()
+		}
+	}
+}
+
+func (d *daemon) reconcileLoop(ctx, runCtx context.Context, session *logger.Session, h *host) {
+	var tick <-chan time.Time
+	if d.global.ReconcileInterval > 0 {
+		ticker := time.NewTicker(d.global.ReconcileInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.trigger:
+		case <-tick:
+		}
+
+		if err := d.reconcile(ctx, runCtx, session, h); err != nil && ctx.Err() == nil {
+			session.Error("Failed to reconcile jobs: %v", err)
+		}
+	}
+}
+
+type desiredJob struct {
+	job     job
+	config  *scheduler.Config
+	hash    string
+	running bool
+	created int64
+}
+
+// reconcile computes the jobs wanted by all containers, including Swarm
+// tasks this agent is responsible for, and diffs them
+// against the scheduled ones. Jobs nothing wants anymore are removed and
+// only jobs that are new or whose hash changed get new schedulers, so
+// running and queued backups of unchanged jobs are left alone.
+func (d *daemon) reconcile(ctx, runCtx context.Context, session *logger.Session, h *host) error {
+	containers, err := h.cli.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		err = fmt.Errorf("failed to list containers: %v", err)
+		h.setConnected(err)
+		return err
+	}
+	h.setConnected(nil)
+	h.detectEngine(ctx, session)
+
+	// Followers schedule nothing; they only stand by to take over.
+	if !d.leading() {
+		containers = nil
+	}
+
+	view := &swarmView{}
+	for _, c := range containers {
+		if _, _, ok := swarmTask(c.Labels); ok {
+			view, err = h.swarmView(ctx)
+			if err != nil {
+				session.Warn("Reading container labels only and backing up tasks in slot 1: %v", err)
+			} else if view.owners == nil && !h.workerWarned {
+				session.Warn("Not a Swarm manager: reading container labels only, backing up tasks in slot 1 and leaving global services to the leader's agent")
+				h.workerWarned = true
+			}
+			break
+		}
+	}
+
+	desired := make(map[string]desiredJob)
+	for _, c := range containers {
+		if !h.managed(c) {
+			continue
+		}
+		rawLabels := taskLabels(c.Labels, view.services)
+		labels := extractLabels(rawLabels)
+		if len(labels) == 0 || !view.ownsTask(rawLabels) {
+			continue
+		}
+
+		j := h.job(c.ID, containerName(c.Names), rawLabels)
+		hash := j.hash(rawLabels)
+
+		config, err := parseConfig(d.global, labels)
+		if err != nil {
+			// Report broken labels once rather than on every reconcile.
+			if h.invalid[j.Name] != hash {
+				session.Error("Failed to parse config of job %s: %v", j, err)
+				h.invalid[j.Name] = hash
+			}
+			continue
+		}
+		delete(h.invalid, j.Name)
+
+		// Paused and stopped containers count as not running.
+		running := c.State == "running"
+		if !config.Enabled || !running && provider.NeedsRunning(config.Provider) {
+			continue
+		}
+
+		// Several containers can share a job, e.g. while one is recreated.
+		// Prefer a running one, then the newest.
+		if cur, ok := desired[j.Name]; ok {
+			if cur.running && !running || cur.running == running && cur.created > c.Created {
+				continue
+			}
+		}
+		desired[j.Name] = desiredJob{job: j, config: config, hash: hash, running: running, created: c.Created}
+	}
+
+	current := h.mgr.Jobs()
+	for name, cur := range current {
+		if _, ok := desired[name]; ok {
+			continue
+		}
+		if h.mgr.RemoveScheduler(name, cur.ContainerID) {
+			session.Info("Removed scheduler for job: %s", name)
+		}
+	}
+
+	for name, want := range desired {
+		if cur, ok := current[name]; ok && cur.Hash == want.hash {
+			continue
+		}
+		if err := d.schedule(runCtx, want.job, want.config, want.hash); err != nil {
+			session.Error("Failed to schedule job %s: %v", want.job, err)
+		}
+	}
+
+	return nil
+}